@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/NgeKaworu/time-mgt-go/src/app"
 	"github.com/NgeKaworu/time-mgt-go/src/db"
@@ -26,10 +27,11 @@ func main() {
 	var (
 		addr   = flag.String("l", ":8050", "绑定Host地址")
 		dbinit = flag.Bool("i", false, "init database flag")
-		mongo  = flag.String("m", "mongodb://localhost:27017", "mongod addr flag")
+		mongo  = flag.String("m", "mongodb://localhost:27017", "mongod addr flag, 须为副本集以支持事务, 如 mongodb://localhost:27017/?replicaSet=rs0")
 		mdb    = flag.String("db", "time-mgt", "database name")
 		ucHost = flag.String("uc", "https://api.furan.xyz/user-center", "user center host")
 		r      = flag.String("r", "localhost:6379", "rdb addr")
+		rt     = flag.Int("rt", 1, "timer rdb index, apart from the auth tokens in db 0")
 	)
 	flag.Parse()
 
@@ -48,7 +50,14 @@ func main() {
 		DB:       0,  // use default DB
 	})
 
-	app := app.New(ucHost, mongoClient, rdb)
+	// 计时器与鉴权令牌分库存放, 清空或误覆盖其中一个不会影响另一个
+	timerRDB := redis.NewClient(&redis.Options{
+		Addr:     *r,
+		Password: "",
+		DB:       *rt,
+	})
+
+	app := app.New(ucHost, mongoClient, rdb, timerRDB)
 	if err != nil {
 		panic(err)
 	}
@@ -59,14 +68,62 @@ func main() {
 	router.PUT("/v1/tag/update", app.SetTag)
 	router.GET("/v1/tag/list", app.ListTag)
 	router.DELETE("/v1/tag/:id", app.RemoveTag)
+	router.POST("/v1/tag/merge", app.MergeTag)
+	router.PUT("/v1/tag/archive/:id", app.ArchiveTag)
+	router.PUT("/v1/tag/unarchive/:id", app.UnarchiveTag)
+	router.PUT("/v1/tag/reorder", app.ReorderTag)
+	router.PUT("/v1/tag/move", app.MoveTag)
+	//tag group ctrl
+	router.POST("/v1/tag-group/create", app.AddTagGroup)
+	router.PUT("/v1/tag-group/update", app.SetTagGroup)
+	router.PUT("/v1/tag-group/reorder", app.ReorderTagGroup)
+	router.GET("/v1/tag-group/list", app.ListTagGroup)
+	router.DELETE("/v1/tag-group/:id", app.RemoveTagGroup)
 	//record ctrl
 	router.POST("/v1/record/create", app.AddRecord)
 	router.PUT("/v1/record/update", app.SetRecord)
 	router.GET("/v1/record/list", app.ListRecord)
+	router.GET("/v1/record/search", app.SearchRecord)
+	router.GET("/v1/record/export", app.ExportRecord)
+	router.POST("/v1/record/import", app.ImportRecord)
 	router.DELETE("/v1/record/:id", app.RemoveRecord)
 	router.POST("/v1/record/statistic", app.StatisticRecord)
+	router.POST("/v1/record/statistic/export", app.ExportStatistic)
+	router.POST("/v1/record/distribution", app.DistributionRecord)
+	router.POST("/v1/record/streak", app.StreakRecord)
+	//goal ctrl
+	router.POST("/v1/goal/create", app.AddGoal)
+	router.PUT("/v1/goal/update", app.SetGoal)
+	router.GET("/v1/goal/list", app.ListGoal)
+	router.GET("/v1/goal/progress", app.ProgressGoal)
+	router.DELETE("/v1/goal/:id", app.RemoveGoal)
+	//rule ctrl
+	router.POST("/v1/rule/create", app.AddRule)
+	router.PUT("/v1/rule/update", app.SetRule)
+	router.GET("/v1/rule/list", app.ListRule)
+	router.POST("/v1/rule/apply", app.ApplyRule)
+	router.DELETE("/v1/rule/:id", app.RemoveRule)
+	//timer ctrl
+	router.POST("/v1/timer/start", app.StartTimer)
+	router.POST("/v1/timer/stop", app.StopTimer)
+	router.GET("/v1/timer/current", app.CurrentTimer)
+	//preference ctrl
+	router.GET("/v1/preference", app.GetPreference)
+	router.PUT("/v1/preference", app.SetPreference)
+	//feed ctrl
+	router.POST("/v1/feed/create", app.AddFeed)
+	router.GET("/v1/feed/list", app.ListFeed)
+	router.DELETE("/v1/feed/:id", app.RemoveFeed)
+
+	// 日历订阅以路径中的令牌鉴权, 不经过登录校验
+	public := httprouter.New()
+	public.GET("/v1/ics/:file", app.FeedICS)
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/ics/", public)
+	mux.Handle("/", app.IsLogin(router))
 
-	srv := &http.Server{Handler: app.IsLogin(router), ErrorLog: nil}
+	srv := &http.Server{Handler: mux, ErrorLog: nil}
 	srv.Addr = *addr
 
 	go func() {
@@ -91,6 +148,7 @@ func main() {
 			<-cleanup
 			mongoClient.Close()
 			rdb.Close()
+			timerRDB.Close()
 			fmt.Println("safe exit")
 			cleanupDone <- true
 		}
@@ -7,9 +7,10 @@ import (
 
 // App
 type App struct {
-	uc    *string
-	mongo *db.MongoClient
-	rdb   *redis.Client
+	uc     *string
+	mongo  *db.MongoClient
+	rdb    *redis.Client
+	timers timerStore
 }
 
 // New 工厂方法
@@ -17,11 +18,13 @@ func New(
 	uc *string,
 	mongo *db.MongoClient,
 	rdb *redis.Client,
+	timerRDB *redis.Client,
 ) *App {
 
 	return &App{
 		uc,
 		mongo,
 		rdb,
+		&redisTimers{timerRDB},
 	}
 }
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordCursor 记录分页游标, 以createAt和_id定位, 对客户端不透明
+type recordCursor struct {
+	CreateAt time.Time          `json:"c"`
+	ID       primitive.ObjectID `json:"i"`
+}
+
+// encodeCursor 生成记录的游标
+func encodeCursor(record models.Record) string {
+	b, _ := json.Marshal(recordCursor{
+		CreateAt: *record.CreateAt,
+		ID:       *record.ID,
+	})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor 解析游标
+func decodeCursor(s string) (*recordCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("游标格式错误")
+	}
+	var c recordCursor
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, errors.New("游标格式错误")
+	}
+	return &c, nil
+}
+
+// beyond 按排序方向位于游标之后的记录, order为1时升序, -1时降序
+func (c *recordCursor) beyond(order int) bson.M {
+	op := "$lt"
+	if order > 0 {
+		op = "$gt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"createAt": bson.M{op: c.CreateAt}},
+		bson.M{"createAt": c.CreateAt, "_id": bson.M{op: c.ID}},
+	}}
+}
+
+// pageCursors 一页记录的下一页和上一页游标, 没有时为空.
+// more为按翻页方向之后还有记录, hasCursor为请求带了游标(即翻页方向的反方向还有记录), backward为向前翻页
+func pageCursors(list []models.Record, more, hasCursor, backward bool) (next, prev string) {
+	if len(list) == 0 {
+		return "", ""
+	}
+
+	hasNext, hasPrev := more, hasCursor
+	if backward {
+		hasNext, hasPrev = hasCursor, more
+	}
+	if hasNext {
+		next = encodeCursor(list[len(list)-1])
+	}
+	if hasPrev {
+		prev = encodeCursor(list[0])
+	}
+	return next, prev
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cursorRecord 测试用记录, id的最后一个字节为id, 便于比较大小
+func cursorRecord(createAt time.Time, id byte) models.Record {
+	var oid primitive.ObjectID
+	oid[len(oid)-1] = id
+	return models.Record{ID: &oid, CreateAt: &createAt}
+}
+
+// matchBeyond 在内存中按beyond生成的条件判断记录是否命中
+func matchBeyond(t *testing.T, filter bson.M, record models.Record) bool {
+	t.Helper()
+	for _, branch := range filter["$or"].(bson.A) {
+		ok := true
+		for field, cond := range branch.(bson.M) {
+			var cmp int
+			switch field {
+			case "createAt":
+				at := cursorValue(t, cond, field).(time.Time)
+				switch {
+				case record.CreateAt.After(at):
+					cmp = 1
+				case record.CreateAt.Before(at):
+					cmp = -1
+				}
+			case "_id":
+				id := cursorValue(t, cond, field).(primitive.ObjectID)
+				cmp = bytes.Compare(record.ID[:], id[:])
+			default:
+				t.Fatalf("unexpected field %v", field)
+			}
+
+			switch op := cond.(type) {
+			case bson.M:
+				_, gt := op["$gt"]
+				_, lt := op["$lt"]
+				ok = ok && (gt && cmp > 0 || lt && cmp < 0)
+			default:
+				ok = ok && cmp == 0
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cursorValue 取出条件中比较的值
+func cursorValue(t *testing.T, cond interface{}, field string) interface{} {
+	t.Helper()
+	op, ok := cond.(bson.M)
+	if !ok {
+		return cond
+	}
+	for _, v := range op {
+		return v
+	}
+	t.Fatalf("empty condition on %v", field)
+	return nil
+}
+
+// TestCursorRoundTrip 游标编码后能原样解析回创建时间和id
+func TestCursorRoundTrip(t *testing.T) {
+	createAt := time.Date(2021, 3, 14, 9, 26, 53, 589793000, time.FixedZone("CST", 8*3600))
+	record := cursorRecord(createAt, 7)
+
+	c, err := decodeCursor(encodeCursor(record))
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !c.CreateAt.Equal(createAt) || c.ID != *record.ID {
+		t.Errorf("decodeCursor = %+v, want %v %v", c, createAt, record.ID.Hex())
+	}
+}
+
+// TestDecodeCursorInvalid 不合法的游标统一报格式错误
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"不是base64", "!!!"},
+		{"不是json", "bm90IGpzb24"},
+		{"id格式错误", "eyJjIjoiMjAyMS0wMy0xNFQwMDowMDowMFoiLCJpIjoieHl6In0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.raw); err == nil || err.Error() != "游标格式错误" {
+				t.Errorf("decodeCursor(%q) err = %v, want 游标格式错误", tt.raw, err)
+			}
+		})
+	}
+}
+
+// TestBeyond 创建时间相同时按_id区分先后, 游标本身不在任何方向上
+func TestBeyond(t *testing.T) {
+	base := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	c := recordCursor{CreateAt: base, ID: *cursorRecord(base, 5).ID}
+
+	tests := []struct {
+		name   string
+		record models.Record
+		asc    bool
+		desc   bool
+	}{
+		{"更晚创建", cursorRecord(base.Add(time.Second), 1), true, false},
+		{"更早创建", cursorRecord(base.Add(-time.Second), 9), false, true},
+		{"同时创建, id更大", cursorRecord(base, 6), true, false},
+		{"同时创建, id更小", cursorRecord(base, 4), false, true},
+		{"游标本身", cursorRecord(base, 5), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchBeyond(t, c.beyond(1), tt.record); got != tt.asc {
+				t.Errorf("beyond(1) = %v, want %v", got, tt.asc)
+			}
+			if got := matchBeyond(t, c.beyond(-1), tt.record); got != tt.desc {
+				t.Errorf("beyond(-1) = %v, want %v", got, tt.desc)
+			}
+		})
+	}
+}
+
+// TestPageCursors 只在对应方向还有记录时返回游标
+func TestPageCursors(t *testing.T) {
+	base := time.Date(2021, 3, 14, 9, 0, 0, 0, time.UTC)
+	list := []models.Record{cursorRecord(base, 1), cursorRecord(base, 2), cursorRecord(base, 3)}
+	first, last := encodeCursor(list[0]), encodeCursor(list[2])
+
+	tests := []struct {
+		name      string
+		list      []models.Record
+		more      bool
+		hasCursor bool
+		backward  bool
+		next      string
+		prev      string
+	}{
+		{"第一页", list, true, false, false, last, ""},
+		{"中间页", list, true, true, false, last, first},
+		{"向后翻到最后一页", list, false, true, false, "", first},
+		{"只有一页", list, false, false, false, "", ""},
+		{"before为空取最后一页", list, true, false, true, "", first},
+		{"before为空且只有一页", list, false, false, true, "", ""},
+		{"向前翻的中间页", list, true, true, true, last, first},
+		{"向前翻到第一页", list, false, true, true, last, ""},
+		{"空页", nil, true, true, false, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, prev := pageCursors(tt.list, tt.more, tt.hasCursor, tt.backward)
+			if next != tt.next || prev != tt.prev {
+				t.Errorf("pageCursors = %q, %q, want %q, %q", next, prev, tt.next, tt.prev)
+			}
+		})
+	}
+}
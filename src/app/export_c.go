@@ -0,0 +1,244 @@
+package app
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// tagSeparator 导出/导入csv时多个标签名之间的分隔符
+const tagSeparator = ";"
+
+// exportBatchSize 导出时每批从数据库读取的记录数
+const exportBatchSize = 500
+
+// ExportRecord 以csv导出记录, 筛选和排序参数与记录列表相同
+func (d *App) ExportRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	loc, _, err := d.userCalendar(context.Background(), uid, q.Get("tz"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	filter, err := recordFilter(q, uid, loc)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	sortBy, err := recordSort(q)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	tags, err := d.tagMap(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TRecord)
+	cur, err := t.Find(context.Background(), filter, options.Find().SetSort(sortBy).SetBatchSize(exportBatchSize))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	defer cur.Close(context.Background())
+
+	out, err := resultor.NewCSV(w, "records.csv", []string{"id", "start", "end", "duration", "event", "tags"})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// 开始输出后出错只能中断, 客户端会收到不完整的文件
+	for cur.Next(context.Background()) {
+		var record models.Record
+		if err = cur.Decode(&record); err != nil {
+			log.Println(err)
+			return
+		}
+
+		start, end := record.Interval()
+		var event string
+		if record.Event != nil {
+			event = *record.Event
+		}
+
+		err = out.Write([]string{
+			record.ID.Hex(),
+			start.In(loc).Format(time.RFC3339),
+			end.In(loc).Format(time.RFC3339),
+			end.Sub(start).String(),
+			resultor.CSVText(event),
+			resultor.CSVText(tagNames(record.TID, tags)),
+		})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err = cur.Err(); err != nil {
+		log.Println(err)
+		return
+	}
+	if err = out.Flush(); err != nil {
+		log.Println(err)
+	}
+}
+
+// ExportStatistic 以csv导出统计结果, 参数与统计接口相同
+func (d *App) ExportStatistic(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := d.readStatisticQuery(r)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	var header []string
+	var rows [][]string
+
+	switch {
+	case q.calendar != nil:
+		series, err := d.statisticSeries(context.Background(), q)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		header = []string{"start", "end", "id", "name", "duration", "count", "share"}
+		for _, s := range series {
+			for _, item := range s.Items {
+				row := []string{
+					s.Start.In(q.loc).Format(time.RFC3339),
+					s.End.In(q.loc).Format(time.RFC3339),
+				}
+				rows = append(rows, append(row, statisticRow(item)...))
+			}
+		}
+
+	case q.compare != "":
+		comparison, err := d.statisticCompare(context.Background(), q)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		header = []string{"id", "name", "current", "previous", "delta", "percent"}
+		for _, delta := range comparison.Deltas {
+			var percent string
+			if delta.Percent != nil {
+				percent = strconv.FormatFloat(*delta.Percent, 'f', 2, 64)
+			}
+			rows = append(rows, []string{
+				statisticID(delta.TID, delta.GID),
+				resultor.CSVText(deref(delta.Name)),
+				delta.Current.String(),
+				delta.Previous.String(),
+				delta.Delta.String(),
+				percent,
+			})
+		}
+
+	default:
+		list, err := d.statisticTotal(context.Background(), q)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		header = []string{"id", "name", "duration", "count", "share"}
+		for _, item := range list {
+			rows = append(rows, statisticRow(item))
+		}
+	}
+
+	out, err := resultor.NewCSV(w, "statistic.csv", header)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, row := range rows {
+		if err = out.Write(row); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err = out.Flush(); err != nil {
+		log.Println(err)
+	}
+}
+
+// statisticRow 统计项的csv列: id, 名称, 时长, 记录数, 占比
+func statisticRow(item models.Statistic) []string {
+	var deration time.Duration
+	if item.Deration != nil {
+		deration = *item.Deration
+	}
+	var count, share string
+	if item.Count != nil {
+		count = strconv.FormatInt(*item.Count, 10)
+	}
+	if item.Share != nil {
+		share = strconv.FormatFloat(*item.Share, 'f', 4, 64)
+	}
+
+	return []string{
+		statisticID(item.TID, item.GID),
+		resultor.CSVText(deref(item.Name)),
+		deration.String(),
+		count,
+		share,
+	}
+}
+
+// statisticID 统计项的id, 按分组统计时为分组id, 未打标签时为空
+func statisticID(tid, gid *primitive.ObjectID) string {
+	if gid != nil {
+		return gid.Hex()
+	}
+	if tid != nil {
+		return tid.Hex()
+	}
+	return ""
+}
+
+// tagNames 把标签id转为以tagSeparator连接的标签名, 找不到的标签保留id
+func tagNames(tids *[]primitive.ObjectID, tags map[primitive.ObjectID]models.Tag) string {
+	if tids == nil {
+		return ""
+	}
+
+	names := make([]string, 0, len(*tids))
+	for _, tid := range *tids {
+		if tag, ok := tags[tid]; ok && tag.Name != nil {
+			names = append(names, *tag.Name)
+			continue
+		}
+		names = append(names, tid.Hex())
+	}
+	return strings.Join(names, tagSeparator)
+}
+
+// deref 取字符串指针的值, 为空时返回空串
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,252 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/ics"
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// feedPath 日历订阅的路径前缀, 不经过登录校验
+const feedPath = "/v1/ics/"
+
+// 订阅包含的天数
+const (
+	feedDefaultDays = 90
+	feedMaxDays     = 366
+)
+
+// AddFeed 创建日历订阅, 返回的令牌只在这里出现一次
+func (d *App) AddFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	var name string
+	if len(body) != 0 {
+		p, err := parsup.ParSup().ConvJSON(body)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		name, _ = p["name"].(string)
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	token := hex.EncodeToString(b)
+	hash := feedHash(token)
+	now := time.Now().Local()
+
+	feed := models.Feed{
+		UID:      &uid,
+		Hash:     &hash,
+		CreateAt: &now,
+	}
+	if name != "" {
+		feed.Name = &name
+	}
+
+	res, err := d.mongo.GetColl(models.TFeed).InsertOne(context.Background(), feed)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	id := res.InsertedID.(primitive.ObjectID)
+	url := feedPath + token + ".ics"
+	feed.ID = &id
+	feed.Token = &token
+	feed.URL = &url
+
+	resultor.RetOk(w, feed)
+}
+
+// RemoveFeed 吊销日历订阅
+func (d *App) RemoveFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TFeed)
+
+	res := t.FindOneAndDelete(context.Background(), bson.M{"_id": id, "uid": uid})
+
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "删除成功")
+}
+
+// ListFeed 日历订阅列表, 不含令牌
+func (d *App) ListFeed(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TFeed)
+	cur, err := t.Find(context.Background(), bson.M{"uid": uid}, options.Find().SetSort(bson.M{"createAt": -1}))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	list := make([]models.Feed, 0)
+	err = cur.All(context.Background(), &list)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, list)
+}
+
+// FeedICS 以iCalendar格式输出订阅者最近days天(默认90天)的记录, 每条记录一个事件.
+// 日历应用不能带Authorization头, 以路径中的令牌(/v1/ics/<token>.ics)鉴权
+func (d *App) FeedICS(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	token := strings.TrimSuffix(ps.ByName("file"), ".ics")
+
+	var feed models.Feed
+	t := d.mongo.GetColl(models.TFeed)
+	err := t.FindOneAndUpdate(context.Background(),
+		bson.M{"hash": feedHash(token)},
+		bson.M{"$set": bson.M{"lastUsedAt": time.Now().Local()}},
+	).Decode(&feed)
+	// 日历应用不认识json, 出错时返回纯文本和对应的状态码
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "订阅不存在或已被吊销", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	uid := *feed.UID
+
+	days := feedDefaultDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		days, err = strconv.Atoi(v)
+		if err != nil || days <= 0 || days > feedMaxDays {
+			http.Error(w, "days须为1到"+strconv.Itoa(feedMaxDays)+"的整数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	tags, err := d.tagMap(context.Background(), uid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cur, err := d.mongo.GetColl(models.TRecord).Find(context.Background(), bson.M{
+		"uid":      uid,
+		"createAt": bson.M{"$gte": time.Now().AddDate(0, 0, -days)},
+	}, options.Find().SetSort(bson.M{"createAt": 1}).SetBatchSize(exportBatchSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cur.Close(context.Background())
+
+	name := "time-mgt"
+	if feed.Name != nil {
+		name = *feed.Name
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="time-mgt.ics"`)
+	out := ics.NewWriter(w, name)
+
+	// 开始输出后出错只能中断, 日历应用会在下次拉取时重试
+	for cur.Next(context.Background()) {
+		var record models.Record
+		if err = cur.Decode(&record); err != nil {
+			log.Println(err)
+			return
+		}
+		if err = out.WriteEvent(recordEvent(&record, tags)); err != nil {
+			log.Println(err)
+			return
+		}
+	}
+	if err = cur.Err(); err != nil {
+		log.Println(err)
+		return
+	}
+	if err = out.Close(); err != nil {
+		log.Println(err)
+	}
+}
+
+// recordEvent 把记录转为日历事件, 标签名作为分类, 颜色取第一个标签的颜色
+func recordEvent(record *models.Record, tags map[primitive.ObjectID]models.Tag) ics.Event {
+	start, end := record.Interval()
+	e := ics.Event{
+		UID:   record.ID.Hex() + "@time-mgt",
+		Start: start,
+		End:   end,
+		Stamp: *record.CreateAt,
+	}
+	if record.UpdateAt != nil {
+		e.Stamp = *record.UpdateAt
+	}
+	if record.Event != nil {
+		e.Summary = *record.Event
+	}
+
+	if record.TID != nil {
+		for _, tid := range *record.TID {
+			tag, ok := tags[tid]
+			if !ok || tag.Name == nil {
+				continue
+			}
+			e.Categories = append(e.Categories, *tag.Name)
+		}
+	}
+	return e
+}
+
+// feedHash 令牌的sha256, 数据库中只保存哈希
+func feedHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
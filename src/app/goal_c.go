@@ -0,0 +1,331 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/bucket"
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/NgeKaworu/time-mgt-go/src/utils"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddGoal 添加目标
+func (d *App) AddGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"tid":    "请选择标签",
+		"kind":   "请选择目标类型",
+		"target": "目标时长不能为空",
+		"period": "请选择周期",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = d.checkGoal(uid, p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TGoal)
+	p["uid"] = uid
+	p["createAt"] = time.Now().Local()
+
+	res, err := t.InsertOne(context.Background(), p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, res.InsertedID.(primitive.ObjectID).Hex())
+}
+
+// SetGoal 更新目标
+func (d *App) SetGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"id": "ID不能为空",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = d.checkGoal(uid, p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TGoal)
+	p["uid"] = uid
+	p["updateAt"] = time.Now().Local()
+
+	id := p["id"]
+	delete(p, "id")
+
+	res := t.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": id, "uid": uid},
+		bson.M{"$set": p},
+	)
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// RemoveGoal 删除目标
+func (d *App) RemoveGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TGoal)
+
+	res := t.FindOneAndDelete(context.Background(), bson.M{"_id": id, "uid": uid})
+
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "删除成功")
+}
+
+// ListGoal goal列表
+func (d *App) ListGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+	l := q.Get("limit")
+	s := q.Get("skip")
+
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	limit, _ := strconv.ParseInt(l, 10, 64)
+	skip, _ := strconv.ParseInt(s, 10, 64)
+
+	list, err := d.listGoal(context.Background(), uid, skip, limit)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, list)
+}
+
+// ProgressGoal 各目标在当前周期的进度
+func (d *App) ProgressGoal(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	loc, weekStart, err := d.userCalendar(context.Background(), uid, r.URL.Query().Get("tz"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	goals, err := d.listGoal(context.Background(), uid, 0, 0)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	// 与统计中的层级一致, 只打了子标签的记录也算在父标签的目标上
+	tags, err := d.tagMap(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	now := time.Now().In(loc)
+	list := make([]models.GoalProgress, 0, len(goals))
+
+	for _, goal := range goals {
+		calendar, err := bucket.New(bucket.Unit(*goal.Period), loc, weekStart)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+
+		start := calendar.Floor(now)
+		end := calendar.Next(start)
+		q := &statisticQuery{
+			uid:         uid,
+			start:       &start,
+			end:         &now,
+			tids:        subtree(tags, *goal.TID),
+			attribution: attributionFull,
+			loc:         loc,
+		}
+
+		var achieved time.Duration
+		err = d.eachRecord(context.Background(), q, func(record *models.Record, start, end time.Time) {
+			achieved += end.Sub(start)
+		})
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+
+		progress := models.GoalProgress{
+			Goal:     goal,
+			Start:    &start,
+			End:      &end,
+			Achieved: achieved,
+		}
+		if achieved < *goal.Target {
+			progress.Remaining = *goal.Target - achieved
+		}
+
+		progress.OnTrack = onTrack(*goal.Kind, *goal.Target, achieved, start, end, now)
+
+		list = append(list, progress)
+	}
+
+	resultor.RetOk(w, list)
+}
+
+// onTrack 目标在now时是否达到进度: 至多类型未超出目标即可,
+// 至少类型按周期[start, end)已过去的实际时长比例折算应完成的时长, 夏令时切换日按实际时长计算
+func onTrack(kind string, target, achieved time.Duration, start, end, now time.Time) bool {
+	if kind == models.GoalAtMost {
+		return achieved <= target
+	}
+	elapsed := float64(now.Sub(start)) / float64(end.Sub(start))
+	return float64(achieved) >= float64(target)*elapsed
+}
+
+// listGoal 用户的目标
+func (d *App) listGoal(ctx context.Context, uid primitive.ObjectID, skip, limit int64) ([]models.Goal, error) {
+	t := d.mongo.GetColl(models.TGoal)
+
+	cur, err := t.Find(ctx, bson.M{
+		"uid": uid,
+	}, options.Find().SetSort(bson.M{"createAt": 1}).SetSkip(skip).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Goal, 0)
+	err = cur.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// checkGoal 校验并规整目标参数
+func (d *App) checkGoal(uid primitive.ObjectID, p map[string]interface{}) error {
+	if kind, ok := p["kind"]; ok {
+		if kind != models.GoalAtLeast && kind != models.GoalAtMost {
+			return errors.New("不支持的目标类型")
+		}
+	}
+
+	if period, ok := p["period"]; ok {
+		switch period {
+		case string(bucket.Day), string(bucket.Week), string(bucket.Month):
+		default:
+			return errors.New("不支持的周期")
+		}
+	}
+
+	if v, ok := p["target"]; ok {
+		target, err := utils.Duration(v)
+		if err != nil {
+			return err
+		}
+		if target <= 0 {
+			return errors.New("目标时长必须大于0")
+		}
+		p["target"] = target
+	}
+
+	if tid, ok := p["tid"]; ok {
+		if _, ok := tid.(primitive.ObjectID); !ok {
+			return errors.New("标签id格式错误")
+		}
+
+		t := d.mongo.GetColl(models.TTag)
+		n, err := t.CountDocuments(context.Background(), bson.M{"_id": tid, "uid": uid})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("标签不存在")
+		}
+	}
+
+	return nil
+}
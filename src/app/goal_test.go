@@ -0,0 +1,48 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+)
+
+// TestOnTrack 至少类型按周期内实际已过去的时长折算, 夏令时切换日只有23小时
+func TestOnTrack(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	weekStart := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	weekEnd := weekStart.AddDate(0, 0, 7)
+	dstStart := time.Date(2024, 3, 10, 0, 0, 0, 0, ny)
+	dstEnd := time.Date(2024, 3, 11, 0, 0, 0, 0, ny)
+	dstNoon := time.Date(2024, 3, 10, 12, 0, 0, 0, ny) // 已过去11小时
+
+	tests := []struct {
+		name       string
+		kind       string
+		target     time.Duration
+		achieved   time.Duration
+		start, end time.Time
+		now        time.Time
+		want       bool
+	}{
+		{"至多未超出", models.GoalAtMost, 2 * time.Hour, 2 * time.Hour, weekStart, weekEnd, weekStart, true},
+		{"至多已超出", models.GoalAtMost, 2 * time.Hour, 2*time.Hour + time.Minute, weekStart, weekEnd, weekEnd, false},
+		{"周期刚开始", models.GoalAtLeast, 10 * time.Hour, 0, weekStart, weekEnd, weekStart, true},
+		{"过半完成一半", models.GoalAtLeast, 10 * time.Hour, 5 * time.Hour, weekStart, weekEnd, weekStart.Add(84 * time.Hour), true},
+		{"过半未完成一半", models.GoalAtLeast, 10 * time.Hour, 5*time.Hour - time.Minute, weekStart, weekEnd, weekStart.Add(84 * time.Hour), false},
+		{"周期结束须完成全部", models.GoalAtLeast, 10 * time.Hour, 10*time.Hour - time.Minute, weekStart, weekEnd, weekEnd, false},
+		{"夏令时切换日达到进度", models.GoalAtLeast, 2 * time.Hour, 58 * time.Minute, dstStart, dstEnd, dstNoon, true},
+		{"夏令时切换日未达到进度", models.GoalAtLeast, 2 * time.Hour, 57 * time.Minute, dstStart, dstEnd, dstNoon, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := onTrack(tt.kind, tt.target, tt.achieved, tt.start, tt.end, tt.now); got != tt.want {
+				t.Errorf("onTrack = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/NgeKaworu/time-mgt-go/src/utils"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddTagGroup 添加标签分组
+func (d *App) AddTagGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"name": "分组名不能为空",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TTagGroup)
+	p["uid"] = uid
+	p["createAt"] = time.Now().Local()
+
+	// 新分组排在最后
+	if _, ok := p["sort"]; !ok {
+		n, err := nextSort(context.Background(), t, uid)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		p["sort"] = n
+	}
+
+	res, err := t.InsertOne(context.Background(), p)
+	if err != nil {
+		errMsg := err.Error()
+		if strings.Contains(errMsg, "dup key") {
+			errMsg = "该分组已被创建"
+		}
+
+		resultor.RetFail(w, errors.New(errMsg))
+		return
+	}
+
+	resultor.RetOk(w, res.InsertedID.(primitive.ObjectID).Hex())
+}
+
+// SetTagGroup 更新标签分组
+func (d *App) SetTagGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"id":   "分组id不能为空",
+		"name": "分组名不能为空",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TTagGroup)
+	p["uid"] = uid
+	p["updateAt"] = time.Now().Local()
+
+	id := p["id"]
+	delete(p, "id")
+
+	res := t.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": id, "uid": uid},
+		bson.M{"$set": p},
+	)
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// RemoveTagGroup 删除标签分组, 组内标签变为未分组
+func (d *App) RemoveTagGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = d.mongo.WithTransaction(context.Background(), func(sc mongo.SessionContext) error {
+		err := d.mongo.GetColl(models.TTagGroup).FindOneAndDelete(sc, bson.M{"_id": id, "uid": uid}).Err()
+		if err != nil {
+			return err
+		}
+
+		_, err = d.mongo.GetColl(models.TTag).UpdateMany(sc,
+			bson.M{"uid": uid, "groupId": id},
+			bson.M{"$unset": bson.M{"groupId": ""}},
+		)
+		return err
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, "删除成功")
+}
+
+// ListTagGroup 标签分组列表
+func (d *App) ListTagGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	list, err := d.listTagGroup(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, list)
+}
+
+// ReorderTagGroup 按ids的顺序批量设置分组排序
+func (d *App) ReorderTagGroup(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d.reorder(w, r, models.TTagGroup)
+}
+
+// reorder 按请求中ids的顺序批量设置coll中的sort字段
+func (d *App) reorder(w http.ResponseWriter, r *http.Request, coll string) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	ids, ok := p["ids"].([]interface{})
+	if !ok || len(ids) == 0 {
+		resultor.RetFail(w, errors.New("排序列表不能为空"))
+		return
+	}
+
+	now := time.Now().Local()
+	writes := make([]mongo.WriteModel, 0, len(ids))
+	for i, id := range ids {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id, "uid": uid}).
+			SetUpdate(bson.M{"$set": bson.M{"sort": int64(i), "updateAt": now}}),
+		)
+	}
+
+	_, err = d.mongo.GetColl(coll).BulkWrite(context.Background(), writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// nextSort coll中用户的最大sort加1, 排到最后; 删除或手动排序后数量与最大值不再一致, 不能用计数
+func nextSort(ctx context.Context, coll *mongo.Collection, uid primitive.ObjectID) (int64, error) {
+	var last struct {
+		Sort float64 `bson:"sort"`
+	}
+	err := coll.FindOne(ctx, bson.M{
+		"uid":  uid,
+		"sort": bson.M{"$exists": true},
+	}, options.FindOne().SetSort(bson.M{"sort": -1}).SetProjection(bson.M{"sort": 1})).Decode(&last)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Floor(last.Sort)) + 1, nil
+}
+
+// listTagGroup 用户的标签分组, 按排序返回
+func (d *App) listTagGroup(ctx context.Context, uid primitive.ObjectID) ([]models.TagGroup, error) {
+	t := d.mongo.GetColl(models.TTagGroup)
+
+	cur, err := t.Find(ctx, bson.M{
+		"uid": uid,
+	}, options.Find().SetSort(bson.D{{Key: "sort", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.TagGroup, 0)
+	err = cur.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// groupTags 把标签放入各自的分组, 未分组的标签放在最后一个没有id的分组中
+func groupTags(groups []models.TagGroup, tags []models.Tag) []models.TagGroup {
+	index := make(map[primitive.ObjectID]int, len(groups))
+	for i, g := range groups {
+		index[*g.ID] = i
+		groups[i].Tags = make([]models.Tag, 0)
+	}
+
+	name := models.Ungrouped
+	ungrouped := models.TagGroup{Name: &name, Tags: make([]models.Tag, 0)}
+
+	for _, tag := range tags {
+		if tag.GroupID != nil {
+			if i, ok := index[*tag.GroupID]; ok {
+				groups[i].Tags = append(groups[i].Tags, tag)
+				continue
+			}
+		}
+		ungrouped.Tags = append(ungrouped.Tags, tag)
+	}
+
+	if len(ungrouped.Tags) > 0 {
+		groups = append(groups, ungrouped)
+	}
+	return groups
+}
@@ -0,0 +1,295 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/importer"
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxImportSize 导入文件的最大字节数
+const maxImportSize = 32 << 20
+
+// importBatchSize 导入时每批写入的记录数
+const importBatchSize = 500
+
+// defaultTagColor 导入时新建标签的默认颜色
+const defaultTagColor = "#1890ff"
+
+// ImportRecord 导入记录.
+// 文件可以直接作为请求体, 也可以用multipart的file字段上传;
+// source为来源: csv(默认)为通用csv, toggl/clockify为对应工具导出的csv或json, 项目和标签都转为标签;
+// 通用csv的列名由startColumn/endColumn/durationColumn/eventColumn/tagsColumn指定, 缺省与导出的csv一致,
+// 传空值表示没有这一列, tagSeparator为多个标签名的分隔符;
+// dryRun为true时只校验不写入. 任意一行有错误时都不会写入, 返回各行的错误;
+// 记录按时间顺序分批写入, 每批一个事务, 中途失败时之前的批次已写入, 错误信息中带有已导入的条数
+func (d *App) ImportRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	loc, _, err := d.userCalendar(context.Background(), uid, q.Get("tz"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	src, err := importSource(w, r)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	defer src.Close()
+
+	res, err := importer.Parse(q.Get("source"), src, importMapping(q), loc)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	result, err := d.importEntries(context.Background(), uid, res, q.Get("dryRun") == "true")
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, result)
+}
+
+// importSource 读取上传的文件, 支持multipart的file字段或直接作为请求体
+func importSource(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("请上传文件")
+		}
+		return file, nil
+	}
+
+	if r.ContentLength == 0 {
+		return nil, errors.New("not has body")
+	}
+	return r.Body, nil
+}
+
+// importMapping 从查询参数读取列名映射
+func importMapping(q url.Values) importer.Mapping {
+	m := importer.DefaultMapping()
+	for key, field := range map[string]*string{
+		"startColumn":    &m.Start,
+		"endColumn":      &m.End,
+		"durationColumn": &m.Duration,
+		"eventColumn":    &m.Event,
+		"tagsColumn":     &m.Tags,
+		"tagSeparator":   &m.TagSeparator,
+	} {
+		if _, ok := q[key]; ok {
+			*field = q.Get(key)
+		}
+	}
+	return m
+}
+
+// importEntries 校验解析出的记录并把标签名对应到标签, 没有标签名的按规则自动打标签;
+// 全部通过且不是dryRun时, 新建缺少的标签并按时间顺序分批写入记录
+func (d *App) importEntries(ctx context.Context, uid primitive.ObjectID, res *importer.Result, dryRun bool) (*models.ImportResult, error) {
+	result := &models.ImportResult{
+		DryRun:  dryRun,
+		Total:   res.Total,
+		NewTags: make([]string, 0),
+		Errors:  append(make([]models.ImportError, 0), res.Errors...),
+	}
+
+	tags, err := d.tagMap(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.Tag, len(tags))
+	for _, tag := range tags {
+		if tag.Name != nil {
+			byName[*tag.Name] = tag
+		}
+	}
+
+	var rules []compiledRule
+	newTags := make(map[string]primitive.ObjectID)
+	records := make([]bson.M, 0, len(res.Entries))
+
+	// 与接口参数一样防注入, 只检查不转换
+	deny := parsup.ParSup().SetIsConvOID(false).SetIsConvTime(false)
+
+	for _, entry := range res.Entries {
+		tids := make([]primitive.ObjectID, 0, len(entry.Tags))
+		valid := true
+
+		if _, err := deny.ConvStr(entry.Event); err != nil {
+			result.Errors = append(result.Errors, models.ImportError{
+				Line:    entry.Line,
+				Field:   "event",
+				Message: err.Error(),
+			})
+			valid = false
+		}
+
+		for _, name := range entry.Tags {
+			if _, err := deny.ConvStr(name); err != nil {
+				result.Errors = append(result.Errors, models.ImportError{
+					Line:    entry.Line,
+					Field:   "tags",
+					Message: err.Error() + ": " + name,
+				})
+				valid = false
+				continue
+			}
+
+			if tag, ok := byName[name]; ok {
+				if tag.Archived != nil && *tag.Archived {
+					result.Errors = append(result.Errors, models.ImportError{
+						Line:    entry.Line,
+						Field:   "tags",
+						Message: "不能使用已归档的标签: " + name,
+					})
+					valid = false
+					continue
+				}
+				tids = append(tids, *tag.ID)
+				continue
+			}
+
+			tid, ok := newTags[name]
+			if !ok {
+				tid = primitive.NewObjectID()
+				newTags[name] = tid
+				result.NewTags = append(result.NewTags, name)
+			}
+			tids = append(tids, tid)
+		}
+
+		if valid && len(entry.Tags) == 0 {
+			if rules == nil {
+				rules, err = d.userRules(ctx, uid)
+				if err != nil {
+					return nil, err
+				}
+			}
+			tids = matchRules(rules, entry.Event)
+			if len(tids) == 0 {
+				result.Errors = append(result.Errors, models.ImportError{
+					Line:    entry.Line,
+					Field:   "tags",
+					Message: "请至少选一个标签",
+				})
+				valid = false
+			}
+		}
+
+		if !valid {
+			continue
+		}
+
+		result.Valid++
+		records = append(records, bson.M{
+			"uid":      uid,
+			"tid":      tids,
+			"event":    entry.Event,
+			"startAt":  entry.StartAt,
+			"endAt":    entry.EndAt,
+			"createAt": entry.EndAt,
+			"deration": entry.EndAt.Sub(entry.StartAt),
+		})
+	}
+
+	sort.SliceStable(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Line < result.Errors[j].Line
+	})
+
+	if dryRun || len(result.Errors) != 0 || len(records) == 0 {
+		return result, nil
+	}
+
+	if len(result.NewTags) != 0 {
+		err = d.mongo.WithTransaction(ctx, func(sc mongo.SessionContext) error {
+			t := d.mongo.GetColl(models.TTag)
+			n, err := nextSort(sc, t, uid)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now().Local()
+			docs := make([]interface{}, 0, len(result.NewTags))
+			for i, name := range result.NewTags {
+				color := defaultTagColor
+				// 颜色只是展示用, 不合法时用默认颜色
+				if c, ok := res.Colors[name]; ok && c != "" {
+					if _, err := deny.ConvStr(c); err == nil {
+						color = c
+					}
+				}
+				docs = append(docs, bson.M{
+					"_id":      newTags[name],
+					"uid":      uid,
+					"name":     name,
+					"color":    color,
+					"sort":     n + int64(i),
+					"createAt": now,
+				})
+			}
+			_, err = t.InsertMany(sc, docs)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 按时间顺序分批, 每批只需重算自身时间范围内和紧随其后的连续记录, 事务不会随导入量变大
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i]["createAt"].(time.Time).Before(records[j]["createAt"].(time.Time))
+	})
+
+	t := d.mongo.GetColl(models.TRecord)
+	for i := 0; i < len(records); i += importBatchSize {
+		j := i + importBatchSize
+		if j > len(records) {
+			j = len(records)
+		}
+		batch := make([]interface{}, 0, j-i)
+		for _, record := range records[i:j] {
+			batch = append(batch, record)
+		}
+		from, to := records[i]["createAt"].(time.Time), records[j-1]["createAt"].(time.Time)
+
+		err = d.mongo.WithTransaction(ctx, func(sc mongo.SessionContext) error {
+			if _, err := t.InsertMany(sc, batch); err != nil {
+				return err
+			}
+			return d.reflowBetween(sc, uid, from, to)
+		})
+		if err != nil {
+			return nil, errors.New("已导入" + strconv.Itoa(result.Imported) + "条记录, 之后的写入失败: " + err.Error())
+		}
+		result.Imported = j
+	}
+
+	return result, nil
+}
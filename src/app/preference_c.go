@@ -0,0 +1,194 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultWeekStart 未设置偏好时每周的第一天
+const defaultWeekStart = time.Monday
+
+// GetPreference 获取用户偏好, 未设置的项返回默认值
+func (d *App) GetPreference(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	pref, err := d.preference(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, withDefaults(pref, serverTimezone()))
+}
+
+// withDefaults 给未设置的偏好填上默认值, 服务器时区没有IANA名称时不返回时区
+func withDefaults(pref *models.Preference, tz string) *models.Preference {
+	if pref.Timezone == nil && tz != "" {
+		pref.Timezone = &tz
+	}
+	if pref.WeekStart == nil {
+		weekStart := defaultWeekStart
+		pref.WeekStart = &weekStart
+	}
+	return pref
+}
+
+// serverTimezone 服务器时区的IANA名称. 没有设置TZ时time.Local的名称为"Local", 改从/etc/localtime的链接推断, 推断不出时返回空串
+func serverTimezone() string {
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	link, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	return zoneFromPath(link)
+}
+
+// zoneFromPath 从zoneinfo文件路径中取出时区名, 如/usr/share/zoneinfo/Asia/Shanghai
+func zoneFromPath(path string) string {
+	i := strings.LastIndex(path, "zoneinfo/")
+	if i < 0 {
+		return ""
+	}
+	name := path[i+len("zoneinfo/"):]
+	if _, err := time.LoadLocation(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// SetPreference 更新用户偏好
+func (d *App) SetPreference(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	set := bson.M{
+		"updateAt": time.Now().Local(),
+	}
+
+	if v, ok := p["timezone"]; ok {
+		tz, ok := v.(string)
+		if !ok || tz == "" {
+			resultor.RetFail(w, errors.New("时区不能为空"))
+			return
+		}
+		if _, err := loadLocation(tz); err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		set["timezone"] = tz
+	}
+
+	if v, ok := p["weekStart"]; ok {
+		weekStart, ok := v.(float64)
+		if !ok || weekStart < 0 || weekStart > 6 || weekStart != float64(int(weekStart)) {
+			resultor.RetFail(w, errors.New("每周第一天须为0到6的整数"))
+			return
+		}
+		set["weekStart"] = time.Weekday(weekStart)
+	}
+
+	if v, ok := p["locale"]; ok {
+		locale, ok := v.(string)
+		if !ok || locale == "" || len(locale) > 35 {
+			resultor.RetFail(w, errors.New("语言格式错误"))
+			return
+		}
+		set["locale"] = locale
+	}
+
+	t := d.mongo.GetColl(models.TPreference)
+	_, err = t.UpdateOne(context.Background(),
+		bson.M{"uid": uid},
+		bson.M{
+			"$set":         set,
+			"$setOnInsert": bson.M{"createAt": time.Now().Local()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// preference 读取用户偏好, 没有时返回空偏好
+func (d *App) preference(ctx context.Context, uid primitive.ObjectID) (*models.Preference, error) {
+	var pref models.Preference
+	err := d.mongo.GetColl(models.TPreference).FindOne(ctx, bson.M{"uid": uid}).Decode(&pref)
+	if err == mongo.ErrNoDocuments {
+		return &models.Preference{UID: &uid}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pref, nil
+}
+
+// userCalendar 用户的时区和每周第一天, tz不为空时覆盖偏好中的时区, 都没有时使用服务器时区
+func (d *App) userCalendar(ctx context.Context, uid primitive.ObjectID, tz string) (*time.Location, time.Weekday, error) {
+	pref, err := d.preference(ctx, uid)
+	if err != nil {
+		return nil, 0, err
+	}
+	return calendarOf(pref, tz)
+}
+
+// calendarOf 由偏好得出时区和每周第一天, tz不为空时覆盖偏好中的时区
+func calendarOf(pref *models.Preference, tz string) (*time.Location, time.Weekday, error) {
+	weekStart := defaultWeekStart
+	if pref.WeekStart != nil {
+		weekStart = *pref.WeekStart
+	}
+
+	if tz == "" && pref.Timezone != nil {
+		tz = *pref.Timezone
+	}
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return loc, weekStart, nil
+}
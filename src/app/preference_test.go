@@ -0,0 +1,101 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+)
+
+func TestCalendarOf(t *testing.T) {
+	shanghai, sunday := "Asia/Shanghai", time.Sunday
+
+	tests := []struct {
+		name      string
+		pref      models.Preference
+		tz        string
+		wantLoc   string
+		wantStart time.Weekday
+		err       bool
+	}{
+		{name: "未设置偏好时为服务器时区和周一", wantLoc: time.Local.String(), wantStart: time.Monday},
+		{name: "偏好中的时区和每周第一天", pref: models.Preference{Timezone: &shanghai, WeekStart: &sunday}, wantLoc: shanghai, wantStart: time.Sunday},
+		{name: "请求的时区优先", pref: models.Preference{Timezone: &shanghai}, tz: "America/New_York", wantLoc: "America/New_York", wantStart: time.Monday},
+		{name: "未知的时区", tz: "Mars/Olympus", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, weekStart, err := calendarOf(&tt.pref, tt.tz)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("calendarOf = %v, want error", loc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.String() != tt.wantLoc || weekStart != tt.wantStart {
+				t.Errorf("calendarOf = %v, %v, want %v, %v", loc, weekStart, tt.wantLoc, tt.wantStart)
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	pref := withDefaults(&models.Preference{}, "")
+	if pref.Timezone != nil {
+		t.Errorf("timezone = %q, want unset when the server zone has no name", *pref.Timezone)
+	}
+	if pref.WeekStart == nil || *pref.WeekStart != defaultWeekStart {
+		t.Errorf("weekStart = %v", pref.WeekStart)
+	}
+
+	pref = withDefaults(&models.Preference{}, "Asia/Shanghai")
+	if pref.Timezone == nil || *pref.Timezone != "Asia/Shanghai" {
+		t.Errorf("timezone = %v", pref.Timezone)
+	}
+
+	tz, sunday := "Europe/Berlin", time.Sunday
+	pref = withDefaults(&models.Preference{Timezone: &tz, WeekStart: &sunday}, "Asia/Shanghai")
+	if *pref.Timezone != tz || *pref.WeekStart != sunday {
+		t.Errorf("pref = %v, %v", *pref.Timezone, *pref.WeekStart)
+	}
+}
+
+func TestZoneFromPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/usr/share/zoneinfo/Asia/Shanghai", "Asia/Shanghai"},
+		{"../usr/share/zoneinfo/America/New_York", "America/New_York"},
+		{"/var/db/timezone/zoneinfo/UTC", "UTC"},
+		{"/usr/share/zoneinfo/Not/AZone", ""},
+		{"/etc/localtime.bak", ""},
+	}
+	for _, tt := range tests {
+		if got := zoneFromPath(tt.in); got != tt.want {
+			t.Errorf("zoneFromPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDateInLocation(t *testing.T) {
+	loc, err := loadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start, err := parseDate("2024-01-15", loc, false)
+	if err != nil || !start.Equal(time.Date(2024, 1, 14, 16, 0, 0, 0, time.UTC)) {
+		t.Errorf("start = %v, %v", start, err)
+	}
+	end, err := parseDate("2024-01-15", loc, true)
+	if err != nil || !end.Equal(time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC).Add(-time.Nanosecond)) {
+		t.Errorf("end = %v, %v", end, err)
+	}
+	if _, err = parseDate("15/01/2024", loc, false); err == nil {
+		t.Error("invalid date should fail")
+	}
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// queryTime 读取时间参数, 支持RFC3339时间或loc时区的日期(2006-01-02), 未传时返回nil.
+// 日期作为终点(end为true)时取当天最后一刻
+func queryTime(q url.Values, key string, loc *time.Location, end bool) (*time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	if day, err := time.ParseInLocation("2006-01-02", v, loc); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &day, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, errors.New(key + "时间格式错误")
+	}
+	t = t.In(loc)
+	return &t, nil
+}
+
+// queryObjectIDs 读取逗号分隔的id参数
+func queryObjectIDs(q url.Values, key string) ([]primitive.ObjectID, error) {
+	res := make([]primitive.ObjectID, 0)
+	for _, v := range strings.Split(q.Get(key), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		oid, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return nil, errors.New(key + "格式错误")
+		}
+		res = append(res, oid)
+	}
+	return res, nil
+}
+
+// queryDuration 读取时长参数, 支持纳秒数或"1h30m"格式, 未传时返回nil
+func queryDuration(q url.Values, key string) (*time.Duration, error) {
+	v := q.Get(key)
+	if v == "" {
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n < 0 {
+			return nil, errors.New(key + "时长不能为负")
+		}
+		d := time.Duration(n)
+		return &d, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, errors.New(key + "时长格式错误")
+	}
+	if d < 0 {
+		return nil, errors.New(key + "时长不能为负")
+	}
+	return &d, nil
+}
+
+// recordFilter 记录列表的筛选条件:
+// start/end 时间范围(日期按loc时区解释), tids 标签(tidMode为all时须包含全部标签, 默认任一),
+// minDeration/maxDeration 时长范围
+func recordFilter(q url.Values, uid primitive.ObjectID, loc *time.Location) (bson.M, error) {
+	filter := bson.M{
+		"uid": uid,
+	}
+
+	start, err := queryTime(q, "start", loc, false)
+	if err != nil {
+		return nil, err
+	}
+	end, err := queryTime(q, "end", loc, true)
+	if err != nil {
+		return nil, err
+	}
+	if start != nil && end != nil && start.After(*end) {
+		return nil, errors.New("开始时间不能晚于结束时间")
+	}
+	if start != nil || end != nil {
+		createAt := bson.M{}
+		if start != nil {
+			createAt["$gte"] = *start
+		}
+		if end != nil {
+			createAt["$lte"] = *end
+		}
+		filter["createAt"] = createAt
+	}
+
+	tids, err := queryObjectIDs(q, "tids")
+	if err != nil {
+		return nil, err
+	}
+	if len(tids) > 0 {
+		switch q.Get("tidMode") {
+		case "", "any":
+			filter["tid"] = bson.M{"$in": tids}
+		case "all":
+			filter["tid"] = bson.M{"$all": tids}
+		default:
+			return nil, errors.New("不支持的标签匹配方式")
+		}
+	}
+
+	minDeration, err := queryDuration(q, "minDeration")
+	if err != nil {
+		return nil, err
+	}
+	maxDeration, err := queryDuration(q, "maxDeration")
+	if err != nil {
+		return nil, err
+	}
+	if minDeration != nil && maxDeration != nil && *minDeration > *maxDeration {
+		return nil, errors.New("最短时长不能大于最长时长")
+	}
+	if minDeration != nil || maxDeration != nil {
+		deration := bson.M{}
+		if minDeration != nil {
+			deration["$gte"] = *minDeration
+		}
+		if maxDeration != nil {
+			deration["$lte"] = *maxDeration
+		}
+		filter["deration"] = deration
+	}
+
+	return filter, nil
+}
+
+// recordSort 记录列表的排序: sort 为createAt或deration, order 为asc或desc, 默认按创建时间倒序
+func recordSort(q url.Values) (bson.D, error) {
+	key := q.Get("sort")
+	switch key {
+	case "":
+		key = "createAt"
+	case "createAt", "deration":
+	default:
+		return nil, errors.New("不支持的排序方式")
+	}
+
+	order := -1
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		order = 1
+	default:
+		return nil, errors.New("不支持的排序方向")
+	}
+
+	return bson.D{{Key: key, Value: order}, {Key: "_id", Value: order}}, nil
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestQueryDuration 支持纳秒数和Go时长格式, 不接受负数
+func TestQueryDuration(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		wantNil bool
+		wantErr bool
+	}{
+		{raw: "", wantNil: true},
+		{raw: "5400000000000", want: 90 * time.Minute},
+		{raw: "1h30m", want: 90 * time.Minute},
+		{raw: "0", want: 0},
+		{raw: "一小时", wantErr: true},
+		{raw: "1.5", wantErr: true},
+		{raw: "-1", wantErr: true},
+		{raw: "-30m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := queryDuration(url.Values{"d": {tt.raw}}, "d")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("queryDuration(%q) err = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (got == nil) != tt.wantNil || (got != nil && *got != tt.want) {
+				t.Errorf("queryDuration(%q) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecordFilter 日期按时区解释(含夏令时切换日), 多个条件同时生效, 不合法的参数报错
+func TestRecordFilter(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	uid := primitive.NewObjectID()
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	tids := a.Hex() + ", " + b.Hex()
+
+	// 2024-03-10 美东时间切换到夏令时, 当天只有23小时
+	dayStart := time.Date(2024, 3, 10, 0, 0, 0, 0, ny)
+	dayEnd := time.Date(2024, 3, 11, 0, 0, 0, 0, ny).Add(-time.Nanosecond)
+
+	tests := []struct {
+		name    string
+		query   string
+		want    bson.M
+		wantErr string
+	}{
+		{
+			name:  "无条件",
+			query: "",
+			want:  bson.M{"uid": uid},
+		},
+		{
+			name:  "组合条件",
+			query: "start=2024-03-10&end=2024-03-10&tids=" + tids + "&tidMode=all&minDeration=30m&maxDeration=2h",
+			want: bson.M{
+				"uid":      uid,
+				"createAt": bson.M{"$gte": dayStart, "$lte": dayEnd},
+				"tid":      bson.M{"$all": []primitive.ObjectID{a, b}},
+				"deration": bson.M{"$gte": 30 * time.Minute, "$lte": 2 * time.Hour},
+			},
+		},
+		{
+			name:  "RFC3339时间和任一标签",
+			query: "start=2024-03-10T12:00:00Z&tids=" + a.Hex(),
+			want: bson.M{
+				"uid":      uid,
+				"createAt": bson.M{"$gte": time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC).In(ny)},
+				"tid":      bson.M{"$in": []primitive.ObjectID{a}},
+			},
+		},
+		{
+			name:  "只有最长时长",
+			query: "maxDeration=3600000000000",
+			want:  bson.M{"uid": uid, "deration": bson.M{"$lte": time.Hour}},
+		},
+		{name: "开始时间格式错误", query: "start=2024/03/10", wantErr: "start时间格式错误"},
+		{name: "结束时间格式错误", query: "end=tomorrow", wantErr: "end时间格式错误"},
+		{name: "开始晚于结束", query: "start=2024-03-11&end=2024-03-10", wantErr: "开始时间不能晚于结束时间"},
+		{name: "标签id错误", query: "tids=" + a.Hex() + ",xyz", wantErr: "tids格式错误"},
+		{name: "标签匹配方式错误", query: "tids=" + a.Hex() + "&tidMode=none", wantErr: "不支持的标签匹配方式"},
+		{name: "时长格式错误", query: "minDeration=abc", wantErr: "minDeration时长格式错误"},
+		{name: "负时长", query: "maxDeration=-1h", wantErr: "maxDeration时长不能为负"},
+		{name: "最短大于最长", query: "minDeration=2h&maxDeration=1h", wantErr: "最短时长不能大于最长时长"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := recordFilter(q, uid, ny)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("recordFilter(%q) err = %v, want %v", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("recordFilter(%q) err = %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recordFilter(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecordSort 默认按创建时间倒序, 均以_id作为次序
+func TestRecordSort(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    bson.D
+		wantErr string
+	}{
+		{query: "", want: bson.D{{Key: "createAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{query: "sort=deration&order=asc", want: bson.D{{Key: "deration", Value: 1}, {Key: "_id", Value: 1}}},
+		{query: "order=desc", want: bson.D{{Key: "createAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{query: "sort=event", wantErr: "不支持的排序方式"},
+		{query: "order=up", wantErr: "不支持的排序方向"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := recordSort(q)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("recordSort(%q) err = %v, want %v", tt.query, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recordSort(%q) = %v, %v, want %v", tt.query, got, err, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -43,38 +45,28 @@ func (d *App) AddRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		return
 	}
 
-	err = utils.Required(p, map[string]string{
-		"tid": "请至少选一个标签",
-	})
-
-	if err != nil {
-		resultor.RetFail(w, err)
-		return
-	}
-
-	t := d.mongo.GetColl(models.TRecord)
-	var deration time.Duration
-
-	last := t.FindOne(context.Background(), bson.M{"uid": uid}, options.FindOne().SetSort(bson.M{"createAt": -1}))
-	if last.Err() == nil {
-		var record models.Record
-		err = last.Decode(&record)
-		if err == nil {
-			deration = time.Now().Local().Sub(*record.CreateAt)
+	// 没有选标签时按规则自动打标签
+	if tids, _ := p["tid"].([]interface{}); len(tids) == 0 {
+		event, _ := p["event"].(string)
+		matched, err := d.autoTag(context.Background(), uid, event)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
 		}
+		if len(matched) == 0 {
+			resultor.RetFail(w, errors.New("请至少选一个标签"))
+			return
+		}
+		p["tid"] = matched
 	}
 
-	p["uid"] = uid
-	p["createAt"] = time.Now().Local()
-	p["deration"] = deration
-
-	res, err := t.InsertOne(context.Background(), p)
+	id, err := d.createRecord(context.Background(), uid, p)
 	if err != nil {
 		resultor.RetFail(w, err)
 		return
 	}
 
-	resultor.RetOk(w, res.InsertedID.(primitive.ObjectID).Hex())
+	resultor.RetOk(w, id.Hex())
 }
 
 // SetRecord 更新记录
@@ -113,19 +105,61 @@ func (d *App) SetRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 		return
 	}
 
+	// startAt和endAt都传null时, 补录记录转回连续记录
+	unfix := clearInterval(p)
+
+	startAt, endAt, err := parseInterval(p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
 	t := d.mongo.GetColl(models.TRecord)
 	p["uid"] = uid
 	p["updateAt"] = time.Now().Local()
 
+	update := bson.M{"$set": p}
+	if unfix {
+		update["$unset"] = bson.M{"startAt": "", "endAt": ""}
+	}
+
+	if startAt != nil {
+		p["startAt"] = *startAt
+		p["endAt"] = *endAt
+		p["createAt"] = *endAt
+		p["deration"] = endAt.Sub(*startAt)
+	}
+
 	id := p["id"]
 	delete(p, "id")
 
-	res := t.FindOneAndUpdate(context.Background(),
-		bson.M{"_id": id},
-		bson.M{"$set": p},
-	)
-	if res.Err() != nil {
-		resultor.RetFail(w, res.Err())
+	err = d.mongo.WithTransaction(context.Background(), func(sc mongo.SessionContext) error {
+		var old models.Record
+		err := t.FindOneAndUpdate(sc,
+			bson.M{"_id": id, "uid": uid},
+			update,
+		).Decode(&old)
+		if err != nil {
+			return err
+		}
+
+		// 位置不变, 之后的记录不受影响, 只需按前一条记录重算自身
+		if unfix {
+			return d.rechain(sc, uid, &old)
+		}
+
+		if startAt == nil || endAt.Equal(*old.CreateAt) {
+			return nil
+		}
+
+		// 原位置和新位置之后的连续记录都需要重算
+		if err := d.reflow(sc, uid, *old.CreateAt); err != nil {
+			return err
+		}
+		return d.reflow(sc, uid, *endAt)
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
 		return
 	}
 
@@ -147,10 +181,18 @@ func (d *App) RemoveRecord(w http.ResponseWriter, r *http.Request, ps httprouter
 
 	t := d.mongo.GetColl(models.TRecord)
 
-	res := t.FindOneAndDelete(context.Background(), bson.M{"_id": id, "uid": uid})
+	err = d.mongo.WithTransaction(context.Background(), func(sc mongo.SessionContext) error {
+		var old models.Record
+		err := t.FindOneAndDelete(sc, bson.M{"_id": id, "uid": uid}).Decode(&old)
+		if err != nil {
+			return err
+		}
+
+		return d.reflow(sc, uid, *old.CreateAt)
+	})
 
-	if res.Err() != nil {
-		resultor.RetFail(w, res.Err())
+	if err != nil {
+		resultor.RetFail(w, err)
 		return
 	}
 
@@ -172,20 +214,42 @@ func (d *App) ListRecord(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	limit, _ := strconv.ParseInt(l, 10, 64)
 	skip, _ := strconv.ParseInt(s, 10, 64)
 
+	loc, _, err := d.userCalendar(context.Background(), uid, q.Get("tz"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	filter, err := recordFilter(q, uid, loc)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	sortBy, err := recordSort(q)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	// 传了after或before(可以为空)时使用游标分页, 不再统计总数
+	_, after := q["after"]
+	_, before := q["before"]
+	if after || before {
+		d.listRecordByCursor(w, q, filter, sortBy, limit)
+		return
+	}
+
 	t := d.mongo.GetColl(models.TRecord)
 
-	total, err := t.CountDocuments(context.Background(), bson.M{
-		"uid": uid,
-	})
+	total, err := t.CountDocuments(context.Background(), filter)
 
 	if err != nil {
 		resultor.RetFail(w, err)
 		return
 	}
 
-	cur, err := t.Find(context.Background(), bson.M{
-		"uid": uid,
-	}, options.Find().SetSort(bson.M{"createAt": -1}).SetSkip(skip).SetLimit(limit))
+	cur, err := t.Find(context.Background(), filter, options.Find().SetSort(sortBy).SetSkip(skip).SetLimit(limit))
 
 	if err != nil {
 		resultor.RetFail(w, err)
@@ -199,91 +263,120 @@ func (d *App) ListRecord(w http.ResponseWriter, r *http.Request, ps httprouter.P
 		resultor.RetFail(w, err)
 		return
 	}
-	resultor.RetOkWithTotal(w, list, total)
+
+	// 按创建时间排序时同样返回游标, 客户端可以从任意一页转为游标分页
+	var next, prev string
+	if sortBy[0].Key == "createAt" {
+		next, prev = pageCursors(list, skip+int64(len(list)) < total, skip > 0, false)
+	}
+	resultor.RetOkWithTotalCursor(w, list, total, next, prev)
 }
 
-// StatisticRecord 统计record
-func (d *App) StatisticRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
-	if err != nil {
-		resultor.RetFail(w, err)
+// listRecordByCursor 游标分页:
+// after为上一页最后一条的游标, 返回其后的一页, 为空时从第一页开始;
+// before为下一页第一条的游标, 返回其前的一页.
+// 新插入的记录只会出现在已翻过的位置, 不会造成重复或遗漏
+func (d *App) listRecordByCursor(w http.ResponseWriter, q url.Values, filter bson.M, sortBy bson.D, limit int64) {
+	if sortBy[0].Key != "createAt" {
+		resultor.RetFail(w, errors.New("游标分页只支持按创建时间排序"))
 		return
 	}
+	order := sortBy[0].Value.(int)
 
-	body, err := ioutil.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		resultor.RetFail(w, err)
-		return
+	backward := false
+	raw := q.Get("after")
+	if _, ok := q["before"]; ok {
+		backward = true
+		raw = q.Get("before")
 	}
 
-	match := bson.M{
-		"uid": uid,
+	// 向前翻页时反向查询, 取到后再倒回来
+	dir := order
+	if backward {
+		dir = -order
 	}
 
-	if len(body) != 0 {
-		p, err := parsup.ParSup().ConvJSON(body)
+	if raw != "" {
+		c, err := decodeCursor(raw)
 		if err != nil {
 			resultor.RetFail(w, err)
 			return
 		}
-		if dateRange, ok := p["dateRange"].([]interface{}); ok {
-			if len(dateRange) == 2 {
-				match["createAt"] = bson.M{
-					"$gte": dateRange[0],
-					"$lte": dateRange[1],
-				}
-			}
-		}
-
-		if tids, ok := p["tids"].([]interface{}); ok {
-			if len(tids) > 0 {
-				match["tid"] = bson.M{"$in": tids}
-			}
-		}
+		filter["$and"] = bson.A{c.beyond(dir)}
 	}
 
-	pipe := []bson.M{
-		{"$match": match},
-		{
-			"$unwind": bson.M{
-				"path":                       "$tid",
-				"preserveNullAndEmptyArrays": true,
-			},
-		},
-	}
-
-	if tid, ok := match["tid"]; ok {
-		pipe = append(pipe, bson.M{
-			"$match": bson.M{
-				"tid": tid,
-			},
-		})
+	opt := options.Find().SetSort(bson.D{
+		{Key: "createAt", Value: dir},
+		{Key: "_id", Value: dir},
+	})
+	if limit > 0 {
+		// 多取一条判断是否还有下一页
+		opt.SetLimit(limit + 1)
 	}
 
-	pipe = append(pipe,
-		bson.M{"$group": bson.M{
-			"_id":      "$tid",
-			"deration": bson.M{"$sum": "$deration"},
-		}},
-		bson.M{"$sort": bson.M{
-			"deration": -1,
-		}},
-	)
-
 	t := d.mongo.GetColl(models.TRecord)
-	cur, err := t.Aggregate(context.Background(), pipe)
-
+	cur, err := t.Find(context.Background(), filter, opt)
 	if err != nil {
 		resultor.RetFail(w, err)
 		return
 	}
-	record := make([]models.Record, 0)
-	err = cur.All(context.Background(), &record)
+
+	list := make([]models.Record, 0)
+	err = cur.All(context.Background(), &list)
 	if err != nil {
 		resultor.RetFail(w, err)
 		return
 	}
 
-	resultor.RetOk(w, record)
+	more := limit > 0 && int64(len(list)) > limit
+	if more {
+		list = list[:limit]
+	}
+
+	if backward {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+
+	next, prev := pageCursors(list, more, raw != "", backward)
+	resultor.RetOkWithCursor(w, list, next, prev)
+}
+
+// clearInterval startAt和endAt都显式为null时从p中去掉并返回true
+func clearInterval(p map[string]interface{}) bool {
+	startAt, hasStart := p["startAt"]
+	endAt, hasEnd := p["endAt"]
+	if !hasStart || !hasEnd || startAt != nil || endAt != nil {
+		return false
+	}
+	delete(p, "startAt")
+	delete(p, "endAt")
+	return true
+}
+
+// parseInterval 解析起止时间, 均未填写时返回nil
+func parseInterval(p map[string]interface{}) (*time.Time, *time.Time, error) {
+	_, hasStart := p["startAt"]
+	_, hasEnd := p["endAt"]
+	if !hasStart && !hasEnd {
+		return nil, nil, nil
+	}
+	if !hasStart || !hasEnd {
+		return nil, nil, errors.New("开始时间和结束时间须同时填写")
+	}
+
+	startAt, ok := p["startAt"].(time.Time)
+	if !ok {
+		return nil, nil, errors.New("开始时间格式错误")
+	}
+	endAt, ok := p["endAt"].(time.Time)
+	if !ok {
+		return nil, nil, errors.New("结束时间格式错误")
+	}
+	if !endAt.After(startAt) {
+		return nil, nil, errors.New("结束时间必须晚于开始时间")
+	}
+
+	return &startAt, &endAt, nil
 }
@@ -0,0 +1,435 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/NgeKaworu/time-mgt-go/src/utils"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ruleBatchSize 回填规则时每批写入的记录数
+const ruleBatchSize = 500
+
+// compiledRule 编译后的规则
+type compiledRule struct {
+	re   *regexp.Regexp
+	tids []primitive.ObjectID
+}
+
+// AddRule 添加规则
+func (d *App) AddRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := convRule(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"pattern": "匹配规则不能为空",
+		"tid":     "请至少选一个标签",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = d.checkRule(uid, p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TRule)
+	p["uid"] = uid
+	p["createAt"] = time.Now().Local()
+
+	res, err := t.InsertOne(context.Background(), p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, res.InsertedID.(primitive.ObjectID).Hex())
+}
+
+// SetRule 更新规则
+func (d *App) SetRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := convRule(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"id": "ID不能为空",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = d.checkRule(uid, p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TRule)
+	p["uid"] = uid
+	p["updateAt"] = time.Now().Local()
+
+	id := p["id"]
+	delete(p, "id")
+
+	res := t.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": id, "uid": uid},
+		bson.M{"$set": p},
+	)
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// RemoveRule 删除规则
+func (d *App) RemoveRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TRule)
+
+	res := t.FindOneAndDelete(context.Background(), bson.M{"_id": id, "uid": uid})
+
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "删除成功")
+}
+
+// ListRule rule列表
+func (d *App) ListRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	list, err := d.listRule(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, list)
+}
+
+// ApplyRule 对已有记录重新应用规则, 默认只处理未打标签的记录, all为true时给所有匹配的记录追加标签
+func (d *App) ApplyRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	var all bool
+	if len(body) != 0 {
+		p, err := parsup.ParSup().ConvJSON(body)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		all, _ = p["all"].(bool)
+	}
+
+	rules, err := d.userRules(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	filter := bson.M{
+		"uid":   uid,
+		"event": bson.M{"$exists": true},
+	}
+	if !all {
+		filter["$or"] = bson.A{
+			bson.M{"tid": nil},
+			bson.M{"tid": bson.M{"$size": 0}},
+		}
+	}
+
+	t := d.mongo.GetColl(models.TRecord)
+	cur, err := t.Find(context.Background(), filter)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	defer cur.Close(context.Background())
+
+	var updated int64
+	writes := make([]mongo.WriteModel, 0, ruleBatchSize)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		res, err := t.BulkWrite(context.Background(), writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += res.ModifiedCount
+		writes = writes[:0]
+		return nil
+	}
+
+	for cur.Next(context.Background()) {
+		var record models.Record
+		err = cur.Decode(&record)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		if record.Event == nil {
+			continue
+		}
+
+		tids := matchRules(rules, *record.Event)
+		if len(tids) == 0 {
+			continue
+		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": record.ID}).
+			SetUpdate(bson.M{"$addToSet": bson.M{"tid": bson.M{"$each": tids}}}),
+		)
+		if len(writes) == ruleBatchSize {
+			if err = flush(); err != nil {
+				resultor.RetFail(w, err)
+				return
+			}
+		}
+	}
+	if err = cur.Err(); err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if err = flush(); err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, updated)
+}
+
+// listRule 用户的规则
+func (d *App) listRule(ctx context.Context, uid primitive.ObjectID) ([]models.Rule, error) {
+	t := d.mongo.GetColl(models.TRule)
+
+	cur, err := t.Find(ctx, bson.M{
+		"uid": uid,
+	}, options.Find().SetSort(bson.M{"createAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Rule, 0)
+	err = cur.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// userRules 编译用户的规则
+func (d *App) userRules(ctx context.Context, uid primitive.ObjectID) ([]compiledRule, error) {
+	list, err := d.listRule(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := d.tagMap(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	return compileRules(list, tags), nil
+}
+
+// compileRules 编译规则, 不合法的正则记录日志后跳过, 去掉已归档和不存在的标签
+func compileRules(list []models.Rule, tags map[primitive.ObjectID]models.Tag) []compiledRule {
+	rules := make([]compiledRule, 0, len(list))
+	for _, rule := range list {
+		if rule.Pattern == nil || rule.TID == nil {
+			continue
+		}
+		re, err := regexp.Compile(*rule.Pattern)
+		if err != nil {
+			log.Printf("跳过不合法的规则 %v: %v", *rule.Pattern, err)
+			continue
+		}
+
+		tids := make([]primitive.ObjectID, 0, len(*rule.TID))
+		for _, tid := range *rule.TID {
+			tag, ok := tags[tid]
+			if ok && (tag.Archived == nil || !*tag.Archived) {
+				tids = append(tids, tid)
+			}
+		}
+		rules = append(rules, compiledRule{re: re, tids: tids})
+	}
+	return rules
+}
+
+// matchRules 事件匹配到的全部标签, 按规则顺序去重
+func matchRules(rules []compiledRule, event string) []primitive.ObjectID {
+	seen := make(map[primitive.ObjectID]bool)
+	res := make([]primitive.ObjectID, 0)
+	for _, rule := range rules {
+		if !rule.re.MatchString(event) {
+			continue
+		}
+		for _, tid := range rule.tids {
+			if !seen[tid] {
+				seen[tid] = true
+				res = append(res, tid)
+			}
+		}
+	}
+	return res
+}
+
+// autoTag 按规则为事件匹配标签
+func (d *App) autoTag(ctx context.Context, uid primitive.ObjectID, event string) ([]primitive.ObjectID, error) {
+	if event == "" {
+		return nil, nil
+	}
+	rules, err := d.userRules(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return matchRules(rules, event), nil
+}
+
+// convRule 解析规则的请求体. 正则中常有$()[]等符号, pattern保留原始字符串单独校验, 其余字段照常防注入和转换
+func convRule(body []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+
+	pattern, ok := m["pattern"]
+	delete(m, "pattern")
+
+	p, err := parsup.ParSup().ConvMap(m)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		p["pattern"] = pattern
+	}
+	return p, nil
+}
+
+// checkRule 校验规则参数
+func (d *App) checkRule(uid primitive.ObjectID, p map[string]interface{}) error {
+	if v, ok := p["pattern"]; ok {
+		pattern, ok := v.(string)
+		if !ok || pattern == "" {
+			return errors.New("匹配规则不能为空")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return errors.New("匹配规则不是合法的正则表达式")
+		}
+	}
+
+	if v, ok := p["tid"]; ok {
+		tids, ok := v.([]interface{})
+		if !ok || len(tids) == 0 {
+			return errors.New("请至少选一个标签")
+		}
+		for _, tid := range tids {
+			if _, ok := tid.(primitive.ObjectID); !ok {
+				return errors.New("标签id格式错误")
+			}
+		}
+
+		n, err := d.mongo.GetColl(models.TTag).CountDocuments(context.Background(), bson.M{
+			"uid": uid,
+			"_id": bson.M{"$in": tids},
+		})
+		if err != nil {
+			return err
+		}
+		if n != int64(len(tids)) {
+			return errors.New("标签不存在")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConvRule(t *testing.T) {
+	tid := primitive.NewObjectID()
+
+	tests := []struct {
+		name    string
+		body    string
+		pattern string
+		err     bool
+	}{
+		{name: "正则符号", body: `{"pattern": "^(写|读)[代码]{2}$", "tid": ["` + tid.Hex() + `"]}`, pattern: "^(写|读)[代码]{2}$"},
+		{name: "24位十六进制不转为ObjectID", body: `{"pattern": "` + tid.Hex() + `"}`, pattern: tid.Hex()},
+		{name: "RFC3339不转为时间", body: `{"pattern": "2024-01-15T09:00:00Z"}`, pattern: "2024-01-15T09:00:00Z"},
+		{name: "其余字段仍然防注入", body: `{"pattern": "a", "name": {"$gt": ""}}`, err: true},
+		{name: "其余字段的特殊符号", body: `{"pattern": "a", "tid": ["$where"]}`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := convRule([]byte(tt.body))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("convRule = %v, want error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, ok := p["pattern"].(string); !ok || got != tt.pattern {
+				t.Errorf("pattern = %#v, want %q", p["pattern"], tt.pattern)
+			}
+		})
+	}
+
+	p, err := convRule([]byte(`{"pattern": "a", "tid": ["` + tid.Hex() + `"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tids, ok := p["tid"].([]interface{}); !ok || tids[0] != tid {
+		t.Errorf("tid = %#v, want ObjectID", p["tid"])
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	work, project, review, meeting, tags := tagTree()
+	archived := true
+	old := primitive.NewObjectID()
+	tags[old] = models.Tag{ID: &old, Archived: &archived}
+
+	rule := func(pattern string, tids ...primitive.ObjectID) models.Rule {
+		return models.Rule{Pattern: &pattern, TID: &tids}
+	}
+	rules := compileRules([]models.Rule{
+		rule("代码|评审", review, work),
+		rule("(", meeting),
+		rule("^会议", meeting, old),
+		rule("评审", work, project),
+		rule("已删除", primitive.NewObjectID()),
+		{TID: &[]primitive.ObjectID{work}},
+	}, tags)
+
+	if len(rules) != 4 {
+		t.Fatalf("compiled %d rules, want 4", len(rules))
+	}
+
+	tests := []struct {
+		event string
+		want  []primitive.ObjectID
+	}{
+		{"写代码", []primitive.ObjectID{review, work}},
+		{"代码评审", []primitive.ObjectID{review, work, project}},
+		{"会议: 周会", []primitive.ObjectID{meeting}},
+		{"开会议", nil},
+		{"已删除的标签", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := matchRules(rules, tt.event)
+		if len(got) != len(tt.want) {
+			t.Errorf("matchRules(%q) = %v, want %v", tt.event, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("matchRules(%q) = %v, want %v", tt.event, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// snippetRadius 高亮片段在命中词前后保留的字数
+const snippetRadius = 20
+
+// SearchRecord 按事件关键字搜索记录, 支持与记录列表相同的筛选条件, 按相关度排序
+func (d *App) SearchRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q := r.URL.Query()
+	l := q.Get("limit")
+	s := q.Get("skip")
+	keyword := strings.TrimSpace(q.Get("q"))
+
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	if keyword == "" {
+		resultor.RetFail(w, errors.New("请输入关键字"))
+		return
+	}
+
+	limit, _ := strconv.ParseInt(l, 10, 64)
+	skip, _ := strconv.ParseInt(s, 10, 64)
+
+	loc, _, err := d.userCalendar(context.Background(), uid, q.Get("tz"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	filter, err := recordFilter(q, uid, loc)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TRecord)
+	score := bson.M{"$meta": "textScore"}
+
+	text := bson.M{"$text": bson.M{"$search": keyword}}
+	for k, v := range filter {
+		text[k] = v
+	}
+
+	total, err := t.CountDocuments(context.Background(), text)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	opt := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "createAt", Value: -1}}).
+		SetSkip(skip).SetLimit(limit)
+
+	// 文本索引按空格分词, 中文等没有空格的内容搜不到时退回到子串匹配
+	if total == 0 {
+		text = bson.M{"event": bson.M{"$regex": regexp.QuoteMeta(keyword), "$options": "i"}}
+		for k, v := range filter {
+			text[k] = v
+		}
+
+		total, err = t.CountDocuments(context.Background(), text)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+
+		opt = options.Find().
+			SetSort(bson.M{"createAt": -1}).
+			SetSkip(skip).SetLimit(limit)
+	}
+
+	cur, err := t.Find(context.Background(), text, opt)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	list := make([]models.SearchHit, 0)
+	err = cur.All(context.Background(), &list)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	terms := searchTerms(keyword)
+	for i := range list {
+		if list[i].Event != nil {
+			list[i].Snippet = highlight(*list[i].Event, terms)
+		}
+	}
+
+	resultor.RetOkWithTotal(w, list, total)
+}
+
+// searchTerms 关键字中需要高亮的词, 去掉引号和排除词
+func searchTerms(keyword string) []string {
+	terms := make([]string, 0)
+	for _, term := range strings.Fields(keyword) {
+		if strings.HasPrefix(term, "-") {
+			continue
+		}
+		term = strings.Trim(term, `"`)
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		terms = append(terms, keyword)
+	}
+	return terms
+}
+
+// highlight 截取第一个命中词附近的片段, 命中词以<em>包裹, 其余内容做html转义
+func highlight(event string, terms []string) string {
+	spans := matchSpans(event, terms)
+
+	from, to := 0, len(event)
+	if len(spans) > 0 {
+		from = backRunes(event, spans[0][0], snippetRadius)
+		to = forwardRunes(event, spans[0][1], snippetRadius)
+	} else {
+		to = forwardRunes(event, 0, 2*snippetRadius)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	last := from
+	for _, span := range spans {
+		// 片段末尾的命中词只高亮截取到的部分
+		start, end := span[0], span[1]
+		if end > to {
+			end = to
+		}
+		if start >= end {
+			break
+		}
+		b.WriteString(html.EscapeString(event[last:start]))
+		b.WriteString("<em>")
+		b.WriteString(html.EscapeString(event[start:end]))
+		b.WriteString("</em>")
+		last = end
+	}
+	b.WriteString(html.EscapeString(event[last:to]))
+	if to < len(event) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// matchSpans 各词在事件中不区分大小写命中的字节区间, 按位置排序, 重叠或相连的区间合并为一个
+func matchSpans(event string, terms []string) [][]int {
+	spans := make([][]int, 0)
+	for _, term := range terms {
+		if term == "" {
+			continue
+		}
+		re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(term))
+		spans = append(spans, re.FindAllStringIndex(event, -1)...)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+
+	merged := make([][]int, 0, len(spans))
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span[0] <= merged[n-1][1] {
+			if span[1] > merged[n-1][1] {
+				merged[n-1][1] = span[1]
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// backRunes 从字节位置i向前n个字符的位置
+func backRunes(s string, i, n int) int {
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return i
+}
+
+// forwardRunes 从字节位置i向后n个字符的位置
+func forwardRunes(s string, i, n int) int {
+	for ; n > 0 && i < len(s); n-- {
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return i
+}
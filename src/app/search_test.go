@@ -0,0 +1,70 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestSearchTerms 按空白(含全角空格)分词, 去掉引号和排除词, 没有可用的词时整个关键字作为一个词
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyword string
+		want    []string
+	}{
+		{"中文分词", "写代码 开会", []string{"写代码", "开会"}},
+		{"全角空格", "写代码　开会", []string{"写代码", "开会"}},
+		{"引号和排除词", `"deep work" -meeting`, []string{"deep", "work"}},
+		{"只有排除词", "-摸鱼", []string{"-摸鱼"}},
+		{"空引号", `"" 番茄`, []string{"番茄"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTerms(tt.keyword); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("searchTerms(%q) = %q, want %q", tt.keyword, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHighlight 多字节内容按字截取片段, 重叠和相连的命中词合并高亮, 与词的顺序无关
+func TestHighlight(t *testing.T) {
+	long := strings.Repeat("一", 30)
+
+	tests := []struct {
+		name  string
+		event string
+		terms []string
+		want  string
+	}{
+		{"中文", "今天下午写代码两小时", []string{"代码"}, "今天下午写<em>代码</em>两小时"},
+		{"不区分大小写", "Review 代码review", []string{"review"}, "<em>Review</em> 代码<em>review</em>"},
+		{"emoji", "🍅番茄钟🍅", []string{"番茄"}, "🍅<em>番茄</em>钟🍅"},
+		{"短词在前的包含关系", "abcd", []string{"ab", "abc"}, "<em>abc</em>d"},
+		{"长词在前的包含关系", "abcd", []string{"abc", "ab"}, "<em>abc</em>d"},
+		{"部分重叠", "写代码评审", []string{"写代码", "代码评审"}, "<em>写代码评审</em>"},
+		{"相连", "写代码", []string{"写", "代码"}, "<em>写代码</em>"},
+		{"转义", "<b>代码</b>", []string{"代码"}, "&lt;b&gt;<em>代码</em>&lt;/b&gt;"},
+		{"空词", "abc", []string{""}, "abc"},
+		{"截取片段", long + "代码" + long, []string{"代码"},
+			"…" + strings.Repeat("一", 20) + "<em>代码</em>" + strings.Repeat("一", 20) + "…"},
+		{"未命中时取开头", long + long, []string{"代码"}, strings.Repeat("一", 40) + "…"},
+		{"命中词跨过片段末尾", "代码" + strings.Repeat("一", 20) + "测试用例", []string{"代码", "一测试"},
+			"<em>代码</em>" + strings.Repeat("一", 19) + "<em>一</em>…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := highlight(tt.event, tt.terms)
+			if got != tt.want {
+				t.Errorf("highlight(%q, %q) = %q, want %q", tt.event, tt.terms, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("highlight(%q, %q) is not valid utf-8", tt.event, tt.terms)
+			}
+		})
+	}
+}
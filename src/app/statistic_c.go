@@ -0,0 +1,980 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/bucket"
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxBuckets 单次按时间段统计的最大区间数
+const maxBuckets = 5000
+
+// 多标签记录的时长归属方式
+const (
+	attributionFull    = "full"    // 每个标签计全部时长
+	attributionSplit   = "split"   // 各标签平分时长
+	attributionPrimary = "primary" // 只计入第一个标签
+)
+
+// 对比的上期范围
+const (
+	comparePrevious = "previous" // 紧邻的上一个同长度范围
+	compareLastYear = "lastYear" // 去年同期
+)
+
+// statisticQuery 统计参数
+type statisticQuery struct {
+	uid         primitive.ObjectID
+	start       *time.Time
+	end         *time.Time
+	tids        []interface{}
+	attribution string
+	loc         *time.Location
+	weekStart   time.Weekday
+	calendar    *bucket.Calendar // 不为空时按时间段统计
+	compare     string           // 不为空时与上期对比
+	rollup      bool             // 子标签时长汇总到祖先标签
+	byGroup     bool             // 按标签分组而不是标签统计
+}
+
+// StatisticRecord 统计record
+func (d *App) StatisticRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := d.readStatisticQuery(r)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	if q.calendar != nil {
+		series, err := d.statisticSeries(context.Background(), q)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		resultor.RetOk(w, series)
+		return
+	}
+
+	if q.compare != "" {
+		comparison, err := d.statisticCompare(context.Background(), q)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		resultor.RetOk(w, comparison)
+		return
+	}
+
+	record, err := d.statisticTotal(context.Background(), q)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, record)
+}
+
+// DistributionRecord 各标签在一周内每小时的时长分布
+func (d *App) DistributionRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, err := d.readStatisticQuery(r)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	list, err := d.distribution(context.Background(), q)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, list)
+}
+
+// readStatisticQuery 从请求中读取统计参数
+func (d *App) readStatisticQuery(r *http.Request) (*statisticQuery, error) {
+	q, _, err := d.readStatisticParams(r)
+	return q, err
+}
+
+// readStatisticParams 从请求中读取统计参数, 同时返回原始参数供接口读取额外字段
+func (d *App) readStatisticParams(r *http.Request) (*statisticQuery, map[string]interface{}, error) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := make(map[string]interface{})
+	if len(body) != 0 {
+		p, err = parsup.ParSup().ConvJSON(body)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// 请求中的tz优先于用户偏好
+	tz, _ := p["tz"].(string)
+	loc, weekStart, err := d.userCalendar(context.Background(), uid, tz)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q, err := parseStatisticQuery(uid, p, loc, weekStart)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 汇总子标签时, 按父标签筛选也包含只打了子标签的记录; 不汇总时保持按所选标签本身筛选
+	if q.rollup && len(q.tids) > 0 {
+		tids := make([]primitive.ObjectID, 0, len(q.tids))
+		for _, v := range q.tids {
+			if oid, ok := v.(primitive.ObjectID); ok {
+				tids = append(tids, oid)
+			}
+		}
+		tags, err := d.tagMap(context.Background(), uid)
+		if err != nil {
+			return nil, nil, err
+		}
+		q.tids = subtree(tags, tids...)
+	}
+	return q, p, nil
+}
+
+// subtree 标签及其全部子孙, 作为记录的tid筛选条件
+func subtree(tags map[primitive.ObjectID]models.Tag, tids ...primitive.ObjectID) []interface{} {
+	res := make([]interface{}, 0, len(tids))
+	for _, tid := range descendants(tids, tags) {
+		res = append(res, tid)
+	}
+	return res
+}
+
+// parseStatisticQuery 解析统计参数, 时间范围可以是RFC3339时间或loc时区的日期(2006-01-02)
+func parseStatisticQuery(uid primitive.ObjectID, p map[string]interface{}, loc *time.Location, weekStart time.Weekday) (*statisticQuery, error) {
+	q := &statisticQuery{
+		uid:       uid,
+		loc:       loc,
+		weekStart: weekStart,
+	}
+
+	if dateRange, ok := p["dateRange"].([]interface{}); ok {
+		if len(dateRange) == 2 {
+			start, err := parseDate(dateRange[0], loc, false)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseDate(dateRange[1], loc, true)
+			if err != nil {
+				return nil, err
+			}
+			q.start, q.end = &start, &end
+		}
+	}
+
+	if tids, ok := p["tids"].([]interface{}); ok {
+		q.tids = tids
+	}
+
+	q.attribution = attributionFull
+	if attribution, ok := p["attribution"].(string); ok && attribution != "" {
+		switch attribution {
+		case attributionFull, attributionSplit, attributionPrimary:
+			q.attribution = attribution
+		default:
+			return nil, errors.New("不支持的归属方式")
+		}
+	}
+
+	if unit, ok := p["bucket"].(string); ok && unit != "" {
+		calendar, err := bucket.New(bucket.Unit(unit), q.loc, q.weekStart)
+		if err != nil {
+			return nil, err
+		}
+		q.calendar = calendar
+	}
+
+	if rollup, ok := p["rollup"].(bool); ok {
+		q.rollup = rollup
+	}
+
+	if groupBy, ok := p["groupBy"].(string); ok && groupBy != "" {
+		switch groupBy {
+		case "tag":
+		case "group":
+			q.byGroup = true
+		default:
+			return nil, errors.New("不支持的统计维度")
+		}
+		if q.rollup && q.byGroup {
+			return nil, errors.New("按分组统计时不能汇总子标签")
+		}
+	}
+
+	if compare, ok := p["compare"].(string); ok && compare != "" {
+		switch compare {
+		case comparePrevious, compareLastYear:
+			q.compare = compare
+		default:
+			return nil, errors.New("不支持的对比方式")
+		}
+		if q.start == nil {
+			return nil, errors.New("对比统计须指定时间范围")
+		}
+		if q.calendar != nil {
+			return nil, errors.New("按时间段统计不支持对比")
+		}
+	}
+
+	return q, nil
+}
+
+// parseDate 解析时间范围的一端, 日期按loc时区解释, 作为终点时取当天最后一刻
+func parseDate(v interface{}, loc *time.Location, end bool) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.In(loc), nil
+	case string:
+		day, err := time.ParseInLocation("2006-01-02", t, loc)
+		if err != nil {
+			break
+		}
+		if end {
+			return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return day, nil
+	}
+	return time.Time{}, errors.New("时间范围格式错误")
+}
+
+// loadLocation 加载时区, 缺省为服务器时区
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, errors.New("未知的时区: " + tz)
+	}
+	return loc, nil
+}
+
+// match 记录筛选条件
+func (q *statisticQuery) match() bson.M {
+	match := bson.M{
+		"uid": q.uid,
+	}
+
+	if q.start != nil {
+		match["createAt"] = bson.M{
+			"$gte": *q.start,
+			"$lte": *q.end,
+		}
+	}
+
+	if len(q.tids) > 0 {
+		match["tid"] = bson.M{"$in": q.tids}
+	}
+
+	return match
+}
+
+// overlapMatch 与时间范围有交集的记录筛选条件
+func (q *statisticQuery) overlapMatch() bson.M {
+	match := q.match()
+
+	if q.start != nil {
+		// 记录结束于范围开始之后, 且开始于范围结束之前
+		match["createAt"] = bson.M{"$gte": *q.start}
+		match["$expr"] = bson.M{
+			"$lte": bson.A{recordStartExpr, *q.end},
+		}
+	}
+
+	return match
+}
+
+// recordStartExpr 记录开始时间的聚合表达式
+var recordStartExpr = bson.M{
+	"$subtract": bson.A{
+		"$createAt",
+		bson.M{"$divide": bson.A{bson.M{"$ifNull": bson.A{"$deration", 0}}, int64(time.Millisecond)}},
+	},
+}
+
+// statisticTotal 按标签统计总时长
+func (d *App) statisticTotal(ctx context.Context, q *statisticQuery) ([]models.Statistic, error) {
+	if q.rollup {
+		return d.statisticRollup(ctx, q)
+	}
+
+	match := q.match()
+
+	pipe := []bson.M{
+		{"$match": match},
+	}
+
+	switch q.attribution {
+	case attributionSplit:
+		pipe = append(pipe, bson.M{"$addFields": bson.M{
+			"deration": bson.M{"$toLong": bson.M{"$divide": bson.A{
+				"$deration",
+				bson.M{"$max": bson.A{1, bson.M{"$size": bson.M{"$ifNull": bson.A{"$tid", bson.A{}}}}}},
+			}}},
+		}})
+	case attributionPrimary:
+		pipe = append(pipe, bson.M{"$addFields": bson.M{
+			"tid": bson.M{"$arrayElemAt": bson.A{"$tid", 0}},
+		}})
+	}
+
+	pipe = append(pipe, bson.M{
+		"$unwind": bson.M{
+			"path":                       "$tid",
+			"preserveNullAndEmptyArrays": true,
+		},
+	})
+
+	if tid, ok := match["tid"]; ok {
+		pipe = append(pipe, bson.M{
+			"$match": bson.M{
+				"tid": tid,
+			},
+		})
+	}
+
+	pipe = append(pipe,
+		bson.M{"$group": bson.M{
+			"_id":      "$tid",
+			"deration": bson.M{"$sum": "$deration"},
+			"count":    bson.M{"$sum": 1},
+		}},
+		bson.M{"$lookup": bson.M{
+			"from":         models.TTag,
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "tag",
+		}},
+		bson.M{"$unwind": bson.M{
+			"path":                       "$tag",
+			"preserveNullAndEmptyArrays": true,
+		}},
+		bson.M{"$project": bson.M{
+			"deration": 1,
+			"count":    1,
+			"name":     "$tag.name",
+			"color":    "$tag.color",
+		}},
+		bson.M{"$sort": bson.M{
+			"deration": -1,
+		}},
+	)
+
+	t := d.mongo.GetColl(models.TRecord)
+	cur, err := t.Aggregate(ctx, pipe)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Statistic, 0)
+	err = cur.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	fillShare(list)
+
+	if q.byGroup {
+		tags, err := d.tagMap(ctx, q.uid)
+		if err != nil {
+			return nil, err
+		}
+		groups, err := d.listTagGroup(ctx, q.uid)
+		if err != nil {
+			return nil, err
+		}
+		list = groupStatistic(list, tags, groups)
+
+		sort.SliceStable(list, func(i, j int) bool {
+			return *list[i].Deration > *list[j].Deration
+		})
+	}
+
+	return list, nil
+}
+
+// statisticRollup 按标签统计总时长, 子标签的时长汇总到祖先标签.
+// 先按记录的标签组合汇总, 再逐个组合展开到祖先标签, 同一记录在每个标签上只计一次
+func (d *App) statisticRollup(ctx context.Context, q *statisticQuery) ([]models.Statistic, error) {
+	t := d.mongo.GetColl(models.TRecord)
+	cur, err := t.Aggregate(ctx, []bson.M{
+		{"$match": q.match()},
+		{"$group": bson.M{
+			"_id":      "$tid",
+			"deration": bson.M{"$sum": "$deration"},
+			"count":    bson.M{"$sum": 1},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	combos := make([]struct {
+		TID      []primitive.ObjectID `bson:"_id"`
+		Deration time.Duration        `bson:"deration"`
+		Count    int64                `bson:"count"`
+	}, 0)
+	err = cur.All(ctx, &combos)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := d.tagMap(ctx, q.uid)
+	if err != nil {
+		return nil, err
+	}
+
+	type tally struct {
+		deration time.Duration
+		count    int64
+	}
+	sums := make(map[primitive.ObjectID]*tally)
+	order := make([]primitive.ObjectID, 0)
+	for _, combo := range combos {
+		tids, share := attribute(combo.TID, q.attribution, tags)
+		for _, tid := range tids {
+			if !q.accept(tid) {
+				continue
+			}
+			if sums[tid] == nil {
+				sums[tid] = &tally{}
+				order = append(order, tid)
+			}
+			sums[tid].deration += share(tid, combo.Deration)
+			sums[tid].count += combo.Count
+		}
+	}
+
+	list := make([]models.Statistic, 0, len(order))
+	for _, tid := range order {
+		deration, count := sums[tid].deration, sums[tid].count
+		item := newStatistic(tid, tags)
+		item.Deration = &deration
+		item.Count = &count
+		list = append(list, item)
+	}
+	fillRollupShare(list, tags)
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return *list[i].Deration > *list[j].Deration
+	})
+	return list, nil
+}
+
+// statisticCompare 统计本期和上期, 并计算各标签的变化
+func (d *App) statisticCompare(ctx context.Context, q *statisticQuery) (*models.Comparison, error) {
+	var start, end time.Time
+	switch q.compare {
+	case compareLastYear:
+		start, end = bucket.LastYear(*q.start, *q.end, q.loc)
+	default:
+		start, end = bucket.Previous(*q.start, *q.end, q.loc)
+	}
+	pq := *q
+	pq.start, pq.end = &start, &end
+
+	current, err := d.statisticTotal(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := d.statisticTotal(ctx, &pq)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make([]models.StatisticDelta, 0, len(current))
+	// 未打标签和未分组的项没有id, 以名称区分
+	index := make(map[string]int)
+	key := func(v models.Statistic) string {
+		switch {
+		case v.GID != nil:
+			return "group:" + v.GID.Hex()
+		case v.TID != nil:
+			return "tag:" + v.TID.Hex()
+		case v.Name != nil:
+			return *v.Name
+		}
+		return ""
+	}
+
+	for _, v := range current {
+		index[key(v)] = len(deltas)
+		deltas = append(deltas, models.StatisticDelta{
+			TID:     v.TID,
+			GID:     v.GID,
+			Name:    v.Name,
+			Color:   v.Color,
+			Current: *v.Deration,
+		})
+	}
+	for _, v := range previous {
+		i, ok := index[key(v)]
+		if !ok {
+			i = len(deltas)
+			deltas = append(deltas, models.StatisticDelta{
+				TID:   v.TID,
+				GID:   v.GID,
+				Name:  v.Name,
+				Color: v.Color,
+			})
+		}
+		deltas[i].Previous = *v.Deration
+	}
+
+	for i := range deltas {
+		deltas[i].Delta = deltas[i].Current - deltas[i].Previous
+		if deltas[i].Previous != 0 {
+			percent := float64(deltas[i].Delta) / float64(deltas[i].Previous) * 100
+			deltas[i].Percent = &percent
+		}
+	}
+
+	return &models.Comparison{
+		DateRange:         []time.Time{*q.start, *q.end},
+		PreviousDateRange: []time.Time{start, end},
+		Current:           current,
+		Previous:          previous,
+		Deltas:            deltas,
+	}, nil
+}
+
+// statisticSeries 按时间段和标签统计, 返回连续的区间, 没有记录的区间补零
+func (d *App) statisticSeries(ctx context.Context, q *statisticQuery) ([]models.Series, error) {
+	if q.start == nil {
+		return nil, errors.New("按时间段统计须指定时间范围")
+	}
+	if q.calendar.Count(*q.start, *q.end) > maxBuckets {
+		return nil, errors.New("时间范围过大, 请选择更粗的统计粒度")
+	}
+
+	// 未打标签的记录归入NilObjectID
+	type tally struct {
+		deration time.Duration
+		count    int64
+	}
+	sums := make(map[int64]map[primitive.ObjectID]*tally)
+	totals := make(map[primitive.ObjectID]time.Duration)
+
+	tags, err := d.tagMap(ctx, q.uid)
+	if err != nil {
+		return nil, err
+	}
+	rollupTags := q.rollupTags(tags)
+
+	err = d.eachRecord(ctx, q, func(record *models.Record, start, end time.Time) {
+		tids, share := attribute(recordTIDs(record), q.attribution, rollupTags)
+
+		// 跨区间的记录按重叠时长拆分
+		q.calendar.Split(start, end, func(b time.Time, deration time.Duration) {
+			key := b.Unix()
+			if sums[key] == nil {
+				sums[key] = make(map[primitive.ObjectID]*tally)
+			}
+
+			for _, tid := range tids {
+				if !q.accept(tid) {
+					continue
+				}
+				if sums[key][tid] == nil {
+					sums[key][tid] = &tally{}
+				}
+				sums[key][tid].deration += share(tid, deration)
+				sums[key][tid].count++
+				totals[tid] += share(tid, deration)
+			}
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []models.TagGroup
+	if q.byGroup {
+		groups, err = d.listTagGroup(ctx, q.uid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 各区间内标签顺序一致, 按总时长降序
+	order := make([]primitive.ObjectID, 0, len(totals))
+	for tid := range totals {
+		order = append(order, tid)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		if totals[order[i]] != totals[order[j]] {
+			return totals[order[i]] > totals[order[j]]
+		}
+		return order[i].Hex() < order[j].Hex()
+	})
+
+	series := make([]models.Series, 0)
+	for _, start := range q.calendar.Series(*q.start, *q.end) {
+		start := start
+		end := q.calendar.Next(start)
+		items := make([]models.Statistic, 0, len(order))
+		for _, tid := range order {
+			var deration time.Duration
+			var count int64
+			if v := sums[start.Unix()][tid]; v != nil {
+				deration, count = v.deration, v.count
+			}
+			item := newStatistic(tid, tags)
+			item.Deration = &deration
+			item.Count = &count
+			items = append(items, item)
+		}
+		if q.rollup {
+			fillRollupShare(items, tags)
+		} else {
+			fillShare(items)
+		}
+		if q.byGroup {
+			items = groupStatistic(items, tags, groups)
+		}
+		series = append(series, models.Series{
+			Start: &start,
+			End:   &end,
+			Items: items,
+		})
+	}
+
+	return series, nil
+}
+
+// distribution 按星期和小时统计各标签时长
+func (d *App) distribution(ctx context.Context, q *statisticQuery) ([]models.Distribution, error) {
+	hours, err := bucket.New(bucket.Hour, q.loc, q.weekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := d.tagMap(ctx, q.uid)
+	if err != nil {
+		return nil, err
+	}
+	rollupTags := q.rollupTags(tags)
+
+	matrix := make(map[primitive.ObjectID]*[7][24]time.Duration)
+	totals := make(map[primitive.ObjectID]time.Duration)
+	counts := make(map[primitive.ObjectID]int64)
+
+	err = d.eachRecord(ctx, q, func(record *models.Record, start, end time.Time) {
+		tids, share := attribute(recordTIDs(record), q.attribution, rollupTags)
+		for _, tid := range tids {
+			if !q.accept(tid) {
+				continue
+			}
+			if matrix[tid] == nil {
+				matrix[tid] = &[7][24]time.Duration{}
+			}
+			counts[tid]++
+			hours.Split(start, end, func(b time.Time, deration time.Duration) {
+				matrix[tid][b.Weekday()][b.Hour()] += share(tid, deration)
+				totals[tid] += share(tid, deration)
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Distribution, 0, len(matrix))
+	for tid, m := range matrix {
+		deration, count := totals[tid], counts[tid]
+		item := models.Distribution{
+			Statistic: newStatistic(tid, tags),
+			Matrix:    *m,
+		}
+		item.Deration = &deration
+		item.Count = &count
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return *list[i].Deration > *list[j].Deration
+	})
+
+	return list, nil
+}
+
+// eachRecord 遍历与统计范围有交集的记录, 传入的区间已裁剪到统计范围内
+func (d *App) eachRecord(ctx context.Context, q *statisticQuery, fn func(record *models.Record, start, end time.Time)) error {
+	t := d.mongo.GetColl(models.TRecord)
+	cur, err := t.Find(ctx, q.overlapMatch())
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var record models.Record
+		err = cur.Decode(&record)
+		if err != nil {
+			return err
+		}
+		if record.CreateAt == nil {
+			continue
+		}
+
+		start, end := record.Interval()
+		if q.start != nil && start.Before(*q.start) {
+			start = *q.start
+		}
+		if q.end != nil && end.After(*q.end) {
+			end = *q.end
+		}
+
+		fn(&record, start, end)
+	}
+
+	return cur.Err()
+}
+
+// accept 标签是否在统计范围内
+func (q *statisticQuery) accept(tid primitive.ObjectID) bool {
+	if len(q.tids) == 0 {
+		return true
+	}
+	for _, v := range q.tids {
+		if oid, ok := v.(primitive.ObjectID); ok && oid == tid {
+			return true
+		}
+	}
+	return false
+}
+
+// tagMap 用户的全部标签, 以id为key
+func (d *App) tagMap(ctx context.Context, uid primitive.ObjectID) (map[primitive.ObjectID]models.Tag, error) {
+	t := d.mongo.GetColl(models.TTag)
+	cur, err := t.Find(ctx, bson.M{"uid": uid})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]models.Tag, 0)
+	err = cur.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[primitive.ObjectID]models.Tag, len(list))
+	for _, tag := range list {
+		tags[*tag.ID] = tag
+	}
+	return tags, nil
+}
+
+// newStatistic 以标签信息初始化统计项, NilObjectID为未打标签
+func newStatistic(tid primitive.ObjectID, tags map[primitive.ObjectID]models.Tag) models.Statistic {
+	var item models.Statistic
+	if tid.IsZero() {
+		name := models.Untagged
+		item.Name = &name
+		return item
+	}
+
+	item.TID = &tid
+	if tag, ok := tags[tid]; ok {
+		item.Name = tag.Name
+		item.Color = tag.Color
+	}
+	return item
+}
+
+// rollupTags 汇总子标签时返回用于查找祖先的标签, 否则返回nil
+func (q *statisticQuery) rollupTags(tags map[primitive.ObjectID]models.Tag) map[primitive.ObjectID]models.Tag {
+	if !q.rollup {
+		return nil
+	}
+	return tags
+}
+
+// fillRollupShare 汇总子标签后计算占比, 以祖先不在结果中的各项之和为总时长, 避免子标签重复计入
+func fillRollupShare(list []models.Statistic, tags map[primitive.ObjectID]models.Tag) {
+	present := make(map[primitive.ObjectID]bool, len(list))
+	for _, v := range list {
+		if v.TID != nil {
+			present[*v.TID] = true
+		}
+	}
+
+	var total time.Duration
+	for _, v := range list {
+		top := true
+		if v.TID != nil {
+			for _, ancestor := range ancestors(*v.TID, tags) {
+				if present[ancestor] {
+					top = false
+					break
+				}
+			}
+		}
+		if top && v.Deration != nil {
+			total += *v.Deration
+		}
+	}
+
+	for i := range list {
+		share := 0.0
+		if total > 0 && list[i].Deration != nil {
+			share = float64(*list[i].Deration) / float64(total)
+		}
+		list[i].Share = &share
+	}
+}
+
+// groupStatistic 把各标签的统计项按标签分组合并, 未分组的标签合并为一项, 未打标签的项保留
+func groupStatistic(list []models.Statistic, tags map[primitive.ObjectID]models.Tag, groups []models.TagGroup) []models.Statistic {
+	names := make(map[primitive.ObjectID]*string, len(groups))
+	for _, g := range groups {
+		names[*g.ID] = g.Name
+	}
+
+	res := make([]models.Statistic, 0)
+	index := make(map[primitive.ObjectID]int)
+
+	for _, v := range list {
+		if v.TID == nil {
+			res = append(res, v)
+			continue
+		}
+
+		// 分组已删除的标签视为未分组
+		gid := primitive.NilObjectID
+		if g := tags[*v.TID].GroupID; g != nil && names[*g] != nil {
+			gid = *g
+		}
+
+		i, ok := index[gid]
+		if !ok {
+			var deration time.Duration
+			var count int64
+			var share float64
+			item := models.Statistic{Deration: &deration, Count: &count, Share: &share}
+			if gid.IsZero() {
+				name := models.Ungrouped
+				item.Name = &name
+			} else {
+				gid := gid
+				item.GID = &gid
+				item.Name = names[gid]
+			}
+			i = len(res)
+			index[gid] = i
+			res = append(res, item)
+		}
+
+		*res[i].Deration += *v.Deration
+		if v.Count != nil {
+			*res[i].Count += *v.Count
+		}
+		if v.Share != nil {
+			*res[i].Share += *v.Share
+		}
+	}
+
+	return res
+}
+
+// fillShare 计算各项占总时长的比例, 未打标签的项补上名称
+func fillShare(list []models.Statistic) {
+	var total time.Duration
+	for _, v := range list {
+		if v.Deration != nil {
+			total += *v.Deration
+		}
+	}
+
+	for i := range list {
+		share := 0.0
+		if total > 0 && list[i].Deration != nil {
+			share = float64(*list[i].Deration) / float64(total)
+		}
+		list[i].Share = &share
+
+		if list[i].TID == nil && list[i].Name == nil {
+			name := models.Untagged
+			list[i].Name = &name
+		}
+	}
+}
+
+// recordTIDs 记录的标签
+func recordTIDs(record *models.Record) []primitive.ObjectID {
+	if record.TID == nil {
+		return nil
+	}
+	return *record.TID
+}
+
+// attribute 按归属方式返回记录计入的标签及每个标签分得的时长, 未打标签的记录计入NilObjectID.
+// tags不为空时汇总子标签: 记录的标签扩展到全部祖先并去重,
+// 祖先分得记录内其各后代(含自身)的份额之和, 因此同一记录在一个标签上最多计入一次
+func attribute(tids []primitive.ObjectID, mode string, tags map[primitive.ObjectID]models.Tag) ([]primitive.ObjectID, func(tid primitive.ObjectID, d time.Duration) time.Duration) {
+	full := func(tid primitive.ObjectID, d time.Duration) time.Duration { return d }
+
+	if len(tids) == 0 {
+		return []primitive.ObjectID{primitive.NilObjectID}, full
+	}
+	if mode == attributionPrimary {
+		tids = tids[:1]
+	}
+
+	// 每个标签在记录内覆盖了几个原始标签
+	covers := make(map[primitive.ObjectID]int64)
+	res := make([]primitive.ObjectID, 0, len(tids))
+	var n int64
+	seen := make(map[primitive.ObjectID]bool, len(tids))
+	for _, tid := range tids {
+		if seen[tid] {
+			continue
+		}
+		seen[tid] = true
+		n++
+
+		expanded := []primitive.ObjectID{tid}
+		if tags != nil {
+			expanded = append(expanded, ancestors(tid, tags)...)
+		}
+		for _, v := range expanded {
+			if covers[v] == 0 {
+				res = append(res, v)
+			}
+			covers[v]++
+		}
+	}
+
+	if mode != attributionSplit {
+		return res, full
+	}
+	return res, func(tid primitive.ObjectID, d time.Duration) time.Duration {
+		return d * time.Duration(covers[tid]) / time.Duration(n)
+	}
+}
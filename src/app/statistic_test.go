@@ -0,0 +1,121 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// tagTree 工作 > 项目A > 代码评审, 以及独立的会议
+func tagTree() (work, project, review, meeting primitive.ObjectID, tags map[primitive.ObjectID]models.Tag) {
+	work, project, review, meeting = primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	tags = map[primitive.ObjectID]models.Tag{
+		work:    {ID: &work},
+		project: {ID: &project, ParentID: &work},
+		review:  {ID: &review, ParentID: &project},
+		meeting: {ID: &meeting},
+	}
+	return
+}
+
+func TestAttributeRollup(t *testing.T) {
+	work, project, review, meeting, tags := tagTree()
+	hour := time.Hour
+
+	tests := []struct {
+		name string
+		tids []primitive.ObjectID
+		mode string
+		want map[primitive.ObjectID]time.Duration
+	}{
+		{
+			name: "子标签和祖先同时出现时只计一次",
+			tids: []primitive.ObjectID{review, work},
+			mode: attributionFull,
+			want: map[primitive.ObjectID]time.Duration{review: hour, project: hour, work: hour},
+		},
+		{
+			name: "平分时祖先分得各后代份额之和",
+			tids: []primitive.ObjectID{review, meeting},
+			mode: attributionSplit,
+			want: map[primitive.ObjectID]time.Duration{review: hour / 2, project: hour / 2, work: hour / 2, meeting: hour / 2},
+		},
+		{
+			name: "平分时祖先份额不超过整条记录",
+			tids: []primitive.ObjectID{review, project},
+			mode: attributionSplit,
+			want: map[primitive.ObjectID]time.Duration{review: hour / 2, project: hour, work: hour},
+		},
+		{
+			name: "只计第一个标签及其祖先",
+			tids: []primitive.ObjectID{project, meeting},
+			mode: attributionPrimary,
+			want: map[primitive.ObjectID]time.Duration{project: hour, work: hour},
+		},
+		{
+			name: "未打标签",
+			mode: attributionFull,
+			want: map[primitive.ObjectID]time.Duration{primitive.NilObjectID: hour},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tids, share := attribute(tt.tids, tt.mode, tags)
+			if len(tids) != len(tt.want) {
+				t.Fatalf("tids = %v, want %d tags", tids, len(tt.want))
+			}
+			for _, tid := range tids {
+				want, ok := tt.want[tid]
+				if !ok {
+					t.Fatalf("unexpected tag %v", tid)
+				}
+				if got := share(tid, hour); got != want {
+					t.Errorf("share(%v) = %v, want %v", tid, got, want)
+				}
+			}
+		})
+	}
+
+	// 不汇总时保持原有的平分方式
+	tids, share := attribute([]primitive.ObjectID{review, meeting, work}, attributionSplit, nil)
+	if len(tids) != 3 || share(review, 3*hour) != hour {
+		t.Errorf("split without rollup = %v, %v", tids, share(review, 3*hour))
+	}
+}
+
+func TestDescendants(t *testing.T) {
+	work, project, review, meeting, tags := tagTree()
+
+	got := descendants([]primitive.ObjectID{project}, tags)
+	if len(got) != 2 || got[0] != project || got[1] != review {
+		t.Errorf("descendants(project) = %v", got)
+	}
+
+	got = descendants([]primitive.ObjectID{work, review, meeting}, tags)
+	if len(got) != 4 {
+		t.Errorf("descendants(work, review, meeting) = %v", got)
+	}
+}
+
+func TestFillRollupShare(t *testing.T) {
+	work, project, _, meeting, tags := tagTree()
+	item := func(tid primitive.ObjectID, d time.Duration) models.Statistic {
+		return models.Statistic{TID: &tid, Deration: &d}
+	}
+
+	list := []models.Statistic{
+		item(work, 3*time.Hour),
+		item(project, 2*time.Hour),
+		item(meeting, time.Hour),
+	}
+	fillRollupShare(list, tags)
+
+	for i, want := range []float64{0.75, 0.5, 0.25} {
+		if got := *list[i].Share; got != want {
+			t.Errorf("share[%d] = %v, want %v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/bucket"
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/NgeKaworu/time-mgt-go/src/utils"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// streakCalendarDays 未指定时间范围时日历返回的天数
+const streakCalendarDays = 30
+
+// StreakRecord 统计标签的连续达标天数
+func (d *App) StreakRecord(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	q, p, err := d.readStatisticParams(r)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"tid": "请选择标签",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	tid, ok := p["tid"].(primitive.ObjectID)
+	if !ok {
+		resultor.RetFail(w, errors.New("标签id格式错误"))
+		return
+	}
+
+	var threshold time.Duration
+	if minutes, ok := p["minutes"].(float64); ok {
+		threshold = time.Duration(minutes * float64(time.Minute))
+	}
+
+	streak, err := d.streak(context.Background(), q, tid, threshold)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, streak)
+}
+
+// streak 按天汇总标签的全部记录, 计算当前和最长连续达标天数, 以及日历范围内每天的情况
+func (d *App) streak(ctx context.Context, q *statisticQuery, tid primitive.ObjectID, threshold time.Duration) (*models.Streak, error) {
+	days, err := bucket.New(bucket.Day, q.loc, q.weekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	// 与统计中的层级一致, 只打了子标签的记录也算在父标签上
+	tags, err := d.tagMap(ctx, q.uid)
+	if err != nil {
+		return nil, err
+	}
+
+	// 连续天数需要全部历史, 日历才使用请求的时间范围
+	all := &statisticQuery{
+		uid:         q.uid,
+		tids:        subtree(tags, tid),
+		attribution: attributionFull,
+		loc:         q.loc,
+	}
+
+	sums := make(map[int64]time.Duration)
+	err = d.eachRecord(ctx, all, func(record *models.Record, start, end time.Time) {
+		days.Split(start, end, func(b time.Time, deration time.Duration) {
+			sums[b.Unix()] += deration
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	res := &models.Streak{TID: &tid}
+	res.Current, res.Longest = streakRuns(days, sums, threshold, now)
+
+	today := days.Floor(now)
+	start, end := today.AddDate(0, 0, 1-streakCalendarDays), today
+	if q.start != nil {
+		start, end = *q.start, *q.end
+	}
+	if days.Count(start, end) > maxBuckets {
+		return nil, errors.New("时间范围过大")
+	}
+
+	res.Calendar = make([]models.StreakDay, 0)
+	for _, day := range days.Series(start, end) {
+		res.Calendar = append(res.Calendar, models.StreakDay{
+			Date:     day.Format("2006-01-02"),
+			Deration: sums[day.Unix()],
+			Hit:      streakHit(sums, threshold, day),
+		})
+	}
+
+	return res, nil
+}
+
+// streakHit 当天有记录且时长达到阈值
+func streakHit(sums map[int64]time.Duration, threshold time.Duration, day time.Time) bool {
+	deration, ok := sums[day.Unix()]
+	return ok && deration > 0 && deration >= threshold
+}
+
+// streakRuns 按每天的时长计算截至now的当前连续天数和历史最长连续天数, sums以当天起点的Unix秒为键
+func streakRuns(days *bucket.Calendar, sums map[int64]time.Duration, threshold time.Duration, now time.Time) (current, longest int) {
+	hits := make([]time.Time, 0)
+	for key := range sums {
+		day := time.Unix(key, 0).In(days.Loc)
+		if streakHit(sums, threshold, day) {
+			hits = append(hits, day)
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return hits[i].Before(hits[j])
+	})
+
+	run := 0
+	for i, day := range hits {
+		if i > 0 && days.Next(hits[i-1]).Equal(day) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+	}
+
+	// 今天还没结束, 未达标不算中断. 前一天取当天起点之前的一刻, 零点切换夏令时的日子没有零点
+	day := days.Floor(now)
+	if !streakHit(sums, threshold, day) {
+		day = days.Floor(day.Add(-time.Nanosecond))
+	}
+	for streakHit(sums, threshold, day) {
+		current++
+		day = days.Floor(day.Add(-time.Nanosecond))
+	}
+	return current, longest
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/bucket"
+)
+
+// TestStreakRuns 今天未达标不算中断, 中间断开的天重新计数, 夏令时切换日与前后两天相连
+func TestStreakRuns(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2018-11-04 圣保罗在0点切换到夏令时, 当天没有0点
+	sp, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	type day struct {
+		date     string
+		deration time.Duration
+	}
+	tests := []struct {
+		name      string
+		loc       *time.Location
+		days      []day
+		threshold time.Duration
+		now       string
+		current   int
+		longest   int
+	}{
+		{"没有记录", cst, nil, 0, "2024-03-10 10:00", 0, 0},
+		{"今天还未达标", cst, []day{{"2024-03-08", time.Hour}, {"2024-03-09", time.Hour}}, 0, "2024-03-10 10:00", 2, 2},
+		{"今天已达标", cst, []day{{"2024-03-08", time.Hour}, {"2024-03-09", time.Hour}, {"2024-03-10", time.Minute}}, 0, "2024-03-10 10:00", 3, 3},
+		{"昨天也未达标", cst, []day{{"2024-03-07", time.Hour}, {"2024-03-08", time.Hour}}, 0, "2024-03-10 10:00", 0, 2},
+		{"中间断开", cst, []day{
+			{"2024-03-01", time.Hour}, {"2024-03-02", time.Hour}, {"2024-03-03", time.Hour},
+			{"2024-03-05", time.Hour}, {"2024-03-09", time.Hour}, {"2024-03-10", time.Hour},
+		}, 0, "2024-03-10 23:59", 2, 3},
+		{"未达阈值的天算中断", cst, []day{
+			{"2024-03-07", time.Hour}, {"2024-03-08", 30 * time.Minute}, {"2024-03-09", time.Hour},
+		}, time.Hour, "2024-03-10 10:00", 1, 1},
+		{"今天有记录但未达阈值", cst, []day{{"2024-03-09", 2 * time.Hour}, {"2024-03-10", 30 * time.Minute}}, time.Hour, "2024-03-10 22:00", 1, 1},
+		{"春季夏令时", ny, []day{{"2024-03-09", time.Hour}, {"2024-03-10", time.Hour}, {"2024-03-11", time.Hour}}, 0, "2024-03-11 09:00", 3, 3},
+		{"秋季夏令时", ny, []day{{"2024-11-02", time.Hour}, {"2024-11-03", time.Hour}, {"2024-11-04", time.Hour}}, 0, "2024-11-05 09:00", 3, 3},
+		{"当天没有0点", sp, []day{{"2018-11-03", time.Hour}, {"2018-11-04", time.Hour}, {"2018-11-05", time.Hour}}, 0, "2018-11-05 09:00", 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			days, err := bucket.New(bucket.Day, tt.loc, time.Monday)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parse := func(layout, v string) time.Time {
+				at, err := time.ParseInLocation(layout, v, tt.loc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return at
+			}
+
+			sums := make(map[int64]time.Duration)
+			for _, d := range tt.days {
+				sums[days.Floor(parse("2006-01-02 15:04", d.date+" 12:00")).Unix()] += d.deration
+			}
+
+			current, longest := streakRuns(days, sums, tt.threshold, parse("2006-01-02 15:04", tt.now))
+			if current != tt.current || longest != tt.longest {
+				t.Errorf("streakRuns = %v, %v, want %v, %v", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io/ioutil"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -54,10 +56,26 @@ func (d *App) AddTag(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	_, err = d.checkParent(context.Background(), uid, nil, p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
 	t := d.mongo.GetColl(models.TTag)
 	p["uid"] = uid
 	p["createAt"] = time.Now().Local()
 
+	// 新标签排在最后
+	if _, ok := p["sort"]; !ok {
+		n, err := nextSort(context.Background(), t, uid)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		p["sort"] = n
+	}
+
 	res, err := t.InsertOne(context.Background(), p)
 	if err != nil {
 		errMsg := err.Error()
@@ -106,19 +124,38 @@ func (d *App) SetTag(w http.ResponseWriter, r *http.Request, ps httprouter.Param
 		return
 	}
 
+	id, ok := p["id"].(primitive.ObjectID)
+	if !ok {
+		resultor.RetFail(w, errors.New("标签id格式错误"))
+		return
+	}
+	delete(p, "id")
+
+	unsetParent, err := d.checkParent(context.Background(), uid, &id, p)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
 	t := d.mongo.GetColl(models.TTag)
 	p["uid"] = uid
 	p["updateAt"] = time.Now().Local()
 
-	id := p["id"]
-	delete(p, "id")
+	update := bson.M{"$set": p}
+	if unsetParent {
+		update["$unset"] = bson.M{"parentId": ""}
+	}
 
-	res := t.FindOneAndUpdate(context.Background(),
-		bson.M{"_id": id},
-		bson.M{"$set": p},
+	res, err := t.UpdateOne(context.Background(),
+		bson.M{"_id": id, "uid": uid},
+		update,
 	)
-	if res.Err() != nil {
-		resultor.RetFail(w, res.Err())
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if res.MatchedCount == 0 {
+		resultor.RetFail(w, errors.New("标签不存在"))
 		return
 	}
 
@@ -157,6 +194,21 @@ func (d *App) RemoveTag(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 
 	t = d.mongo.GetColl(models.TTag)
 
+	children, err := t.CountDocuments(context.Background(), bson.M{
+		"uid":      uid,
+		"parentId": id,
+	})
+
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	if children != 0 {
+		resultor.RetFail(w, errors.New("不能删除含有子标签的标签。"))
+		return
+	}
+
 	res := t.FindOneAndDelete(context.Background(), bson.M{"_id": id, "uid": uid})
 
 	if res.Err() != nil {
@@ -167,11 +219,366 @@ func (d *App) RemoveTag(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	resultor.RetOk(w, "删除成功")
 }
 
+// ArchiveTag 归档标签
+func (d *App) ArchiveTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d.setArchived(w, r, ps, true)
+}
+
+// UnarchiveTag 取消归档标签
+func (d *App) UnarchiveTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d.setArchived(w, r, ps, false)
+}
+
+// setArchived 设置标签归档状态
+func (d *App) setArchived(w http.ResponseWriter, r *http.Request, ps httprouter.Params, archived bool) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(ps.ByName("id"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	t := d.mongo.GetColl(models.TTag)
+
+	res := t.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": id, "uid": uid},
+		bson.M{"$set": bson.M{
+			"archived": archived,
+			"updateAt": time.Now().Local(),
+		}},
+	)
+	if res.Err() != nil {
+		resultor.RetFail(w, res.Err())
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// ReorderTag 按ids的顺序批量设置标签排序
+func (d *App) ReorderTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	d.reorder(w, r, models.TTag)
+}
+
+// MoveTag 把标签移入分组, groupId为null时移出分组
+func (d *App) MoveTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"ids":     "请选择标签",
+		"groupId": "请选择分组",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	ids, ok := p["ids"].([]interface{})
+	if !ok || len(ids) == 0 {
+		resultor.RetFail(w, errors.New("请选择标签"))
+		return
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"updateAt": time.Now().Local()},
+		"$unset": bson.M{"groupId": ""},
+	}
+
+	if p["groupId"] != nil {
+		gid, ok := p["groupId"].(primitive.ObjectID)
+		if !ok {
+			resultor.RetFail(w, errors.New("分组id格式错误"))
+			return
+		}
+
+		n, err := d.mongo.GetColl(models.TTagGroup).CountDocuments(context.Background(), bson.M{"_id": gid, "uid": uid})
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		if n == 0 {
+			resultor.RetFail(w, errors.New("分组不存在"))
+			return
+		}
+
+		update = bson.M{"$set": bson.M{"groupId": gid, "updateAt": time.Now().Local()}}
+	}
+
+	_, err = d.mongo.GetColl(models.TTag).UpdateMany(context.Background(),
+		bson.M{"_id": bson.M{"$in": ids}, "uid": uid},
+		update,
+	)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, "修改成功")
+}
+
+// MergeTag 合并标签, 引用源标签的记录、子标签和时间目标都改为引用目标标签, 然后删除源标签
+func (d *App) MergeTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if len(body) == 0 {
+		resultor.RetFail(w, errors.New("not has body"))
+		return
+	}
+
+	p, err := parsup.ParSup().ConvJSON(body)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	err = utils.Required(p, map[string]string{
+		"source": "请选择要合并的标签",
+		"target": "请选择合并到的标签",
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	source, ok := p["source"].(primitive.ObjectID)
+	if !ok {
+		resultor.RetFail(w, errors.New("标签id格式错误"))
+		return
+	}
+	target, ok := p["target"].(primitive.ObjectID)
+	if !ok {
+		resultor.RetFail(w, errors.New("标签id格式错误"))
+		return
+	}
+	if source == target {
+		resultor.RetFail(w, errors.New("不能合并到同一个标签"))
+		return
+	}
+
+	tags, err := d.tagMap(context.Background(), uid)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+	if _, ok := tags[source]; !ok {
+		resultor.RetFail(w, errors.New("标签不存在"))
+		return
+	}
+	if _, ok := tags[target]; !ok {
+		resultor.RetFail(w, errors.New("标签不存在"))
+		return
+	}
+
+	err = d.mongo.WithTransaction(context.Background(), func(sc mongo.SessionContext) error {
+		for _, coll := range []string{models.TRecord, models.TRule} {
+			_, err := d.mongo.GetColl(coll).UpdateMany(sc, bson.M{
+				"uid": uid,
+				"tid": source,
+			}, replaceTag(source, target))
+			if err != nil {
+				return err
+			}
+		}
+
+		tag := d.mongo.GetColl(models.TTag)
+
+		// 目标是源的子孙时, 先把目标提到源的位置, 避免成环
+		for _, ancestor := range ancestors(target, tags) {
+			if ancestor != source {
+				continue
+			}
+			update := bson.M{"$unset": bson.M{"parentId": ""}}
+			if parentID := tags[source].ParentID; parentID != nil {
+				update = bson.M{"$set": bson.M{"parentId": *parentID}}
+			}
+			_, err := tag.UpdateOne(sc, bson.M{"_id": target}, update)
+			if err != nil {
+				return err
+			}
+			break
+		}
+
+		_, err := tag.UpdateMany(sc, bson.M{
+			"uid":      uid,
+			"parentId": source,
+			"_id":      bson.M{"$ne": target},
+		}, bson.M{"$set": bson.M{"parentId": target}})
+		if err != nil {
+			return err
+		}
+
+		if err = d.mergeGoals(sc, uid, source, target); err != nil {
+			return err
+		}
+
+		_, err = tag.DeleteOne(sc, bson.M{"_id": source, "uid": uid})
+		return err
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	// 正在进行的计时也换成目标标签, 否则停止时会用已删除的标签生成记录
+	if err = replaceTimerTag(context.Background(), d.timers, uid, source, target); err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, "合并成功")
+}
+
+// mergeGoals 把源标签的目标移到目标标签下, 目标标签已有同类型同周期的目标时删除源标签的目标
+func (d *App) mergeGoals(ctx context.Context, uid, source, target primitive.ObjectID) error {
+	t := d.mongo.GetColl(models.TGoal)
+	cur, err := t.Find(ctx, bson.M{
+		"uid": uid,
+		"tid": bson.M{"$in": bson.A{source, target}},
+	})
+	if err != nil {
+		return err
+	}
+
+	list := make([]models.Goal, 0)
+	if err = cur.All(ctx, &list); err != nil {
+		return err
+	}
+
+	move, drop := splitGoals(list, target)
+	if len(move) != 0 {
+		_, err = t.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": move}}, bson.M{"$set": bson.M{"tid": target}})
+		if err != nil {
+			return err
+		}
+	}
+	if len(drop) != 0 {
+		_, err = t.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": drop}})
+	}
+	return err
+}
+
+// splitGoals 把源标签的目标分为要移到target下的和与target已有目标重复要删除的
+func splitGoals(list []models.Goal, target primitive.ObjectID) (move, drop []primitive.ObjectID) {
+	key := func(g models.Goal) string {
+		var kind, period string
+		if g.Kind != nil {
+			kind = *g.Kind
+		}
+		if g.Period != nil {
+			period = *g.Period
+		}
+		return kind + "/" + period
+	}
+
+	exists := make(map[string]bool)
+	for _, g := range list {
+		if *g.TID == target {
+			exists[key(g)] = true
+		}
+	}
+	for _, g := range list {
+		if *g.TID == target {
+			continue
+		}
+		if k := key(g); exists[k] {
+			drop = append(drop, *g.ID)
+		} else {
+			exists[k] = true
+			move = append(move, *g.ID)
+		}
+	}
+	return move, drop
+}
+
+// replaceTIDs 把tids中所有的源标签换成目标标签并去重, 与replaceTag一致
+func replaceTIDs(tids []primitive.ObjectID, source, target primitive.ObjectID) ([]primitive.ObjectID, bool) {
+	changed := false
+	seen := make(map[primitive.ObjectID]bool, len(tids))
+	res := make([]primitive.ObjectID, 0, len(tids))
+	for _, tid := range tids {
+		if tid == source {
+			tid, changed = target, true
+		}
+		if !seen[tid] {
+			seen[tid] = true
+			res = append(res, tid)
+		}
+	}
+	return res, changed
+}
+
+// replaceTag 把tid中所有的源标签换成目标标签并去重, 保持标签原有的顺序(首个标签决定primary归属)
+func replaceTag(source, target primitive.ObjectID) bson.A {
+	return bson.A{bson.M{"$set": bson.M{"tid": bson.M{
+		"$reduce": bson.M{
+			"input": bson.M{"$map": bson.M{
+				"input": "$tid",
+				"in":    bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$$this", source}}, target, "$$this"}},
+			}},
+			"initialValue": bson.A{},
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$in": bson.A{"$$this", "$$value"}},
+				"$$value",
+				bson.M{"$concatArrays": bson.A{"$$value", bson.A{"$$this"}}},
+			}},
+		},
+	}}}}
+}
+
+// 标签列表排序方式
+const (
+	tagSortName     = "name"     // 名称
+	tagSortCreated  = "created"  // 创建时间
+	tagSortRecent   = "recent"   // 最近使用
+	tagSortMostUsed = "mostUsed" // 使用时长
+	tagSortManual   = "manual"   // 手动排序
+)
+
 // ListTag tag列表
 func (d *App) ListTag(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	q := r.URL.Query()
 	l := q.Get("limit")
 	s := q.Get("skip")
+	sortBy := q.Get("sort")
+	tree, _ := strconv.ParseBool(q.Get("tree"))
+	includeArchived, _ := strconv.ParseBool(q.Get("includeArchived"))
+	withUsage, _ := strconv.ParseBool(q.Get("usage"))
+	grouped, _ := strconv.ParseBool(q.Get("grouped"))
 
 	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
 	if err != nil {
@@ -182,11 +589,48 @@ func (d *App) ListTag(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 	limit, _ := strconv.ParseInt(l, 10, 64)
 	skip, _ := strconv.ParseInt(s, 10, 64)
 
+	// 树形和分组列表需要完整的标签才能组装
+	if tree || grouped {
+		limit, skip = 0, 0
+	}
+
 	t := d.mongo.GetColl(models.TTag)
 
-	cur, err := t.Find(context.Background(), bson.M{
+	filter := bson.M{
 		"uid": uid,
-	}, options.Find().SetSkip(skip).SetLimit(limit))
+	}
+	if !includeArchived {
+		filter["archived"] = bson.M{"$ne": true}
+	}
+
+	total, err := t.CountDocuments(context.Background(), filter)
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	opt := options.Find()
+	switch sortBy {
+	case "", tagSortManual:
+		// 未指定排序方式时按手动排序, 分组和树形列表也保持这个顺序
+		opt.SetSort(bson.D{{Key: "sort", Value: 1}, {Key: "_id", Value: 1}})
+	case tagSortName:
+		opt.SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}})
+	case tagSortCreated:
+		opt.SetSort(bson.D{{Key: "createAt", Value: -1}, {Key: "_id", Value: 1}})
+	case tagSortRecent, tagSortMostUsed:
+		// 按使用情况排序须在内存中完成
+	default:
+		resultor.RetFail(w, errors.New("不支持的排序方式"))
+		return
+	}
+
+	byUsage := sortBy == tagSortRecent || sortBy == tagSortMostUsed
+	if !byUsage {
+		opt.SetSkip(skip).SetLimit(limit)
+	}
+
+	cur, err := t.Find(context.Background(), filter, opt)
 
 	if err != nil {
 		resultor.RetFail(w, err)
@@ -200,5 +644,216 @@ func (d *App) ListTag(w http.ResponseWriter, r *http.Request, ps httprouter.Para
 		resultor.RetFail(w, err)
 		return
 	}
-	resultor.RetOk(w, list)
+
+	if withUsage || byUsage {
+		usage, err := d.tagUsage(context.Background(), uid)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		for i := range list {
+			u, ok := usage[*list[i].ID]
+			if !ok {
+				u = &models.TagUsage{}
+			}
+			list[i].Usage = u
+		}
+	}
+
+	if byUsage {
+		sort.SliceStable(list, func(i, j int) bool {
+			a, b := list[i].Usage, list[j].Usage
+			if sortBy == tagSortMostUsed {
+				return a.Deration > b.Deration
+			}
+			if a.LastUsedAt == nil || b.LastUsedAt == nil {
+				return a.LastUsedAt != nil
+			}
+			return a.LastUsedAt.After(*b.LastUsedAt)
+		})
+		list = paginate(list, skip, limit)
+
+		if !withUsage {
+			for i := range list {
+				list[i].Usage = nil
+			}
+		}
+	}
+
+	if grouped {
+		groups, err := d.listTagGroup(context.Background(), uid)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+
+		groups = groupTags(groups, list)
+		if tree {
+			for i := range groups {
+				groups[i].Tags = buildTagTree(groups[i].Tags)
+			}
+		}
+
+		resultor.RetOkWithTotal(w, groups, total)
+		return
+	}
+
+	if tree {
+		list = buildTagTree(list)
+	}
+
+	resultor.RetOkWithTotal(w, list, total)
+}
+
+// tagUsage 各标签的记录数、总时长和最近使用时间
+func (d *App) tagUsage(ctx context.Context, uid primitive.ObjectID) (map[primitive.ObjectID]*models.TagUsage, error) {
+	t := d.mongo.GetColl(models.TRecord)
+	cur, err := t.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"uid": uid}},
+		{"$unwind": "$tid"},
+		{"$group": bson.M{
+			"_id":        "$tid",
+			"count":      bson.M{"$sum": 1},
+			"deration":   bson.M{"$sum": "$deration"},
+			"lastUsedAt": bson.M{"$max": "$createAt"},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]struct {
+		ID              primitive.ObjectID `bson:"_id"`
+		models.TagUsage `bson:",inline"`
+	}, 0)
+	err = cur.All(ctx, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[primitive.ObjectID]*models.TagUsage, len(list))
+	for i := range list {
+		usage[list[i].ID] = &list[i].TagUsage
+	}
+	return usage, nil
+}
+
+// paginate 在内存中分页, limit为0时不限制
+func paginate(list []models.Tag, skip, limit int64) []models.Tag {
+	if skip < 0 {
+		skip = 0
+	}
+	if skip >= int64(len(list)) {
+		return list[:0]
+	}
+	list = list[skip:]
+	if limit > 0 && limit < int64(len(list)) {
+		list = list[:limit]
+	}
+	return list
+}
+
+// checkParent 校验父标签存在且不成环, parentId传null时返回true表示清除父标签
+func (d *App) checkParent(ctx context.Context, uid primitive.ObjectID, id *primitive.ObjectID, p map[string]interface{}) (bool, error) {
+	v, ok := p["parentId"]
+	if !ok {
+		return false, nil
+	}
+	if v == nil {
+		delete(p, "parentId")
+		return true, nil
+	}
+
+	parentID, ok := v.(primitive.ObjectID)
+	if !ok {
+		return false, errors.New("父标签id格式错误")
+	}
+
+	tags, err := d.tagMap(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := tags[parentID]; !ok {
+		return false, errors.New("父标签不存在")
+	}
+
+	// 沿父标签向上查找, 遇到自己说明成环
+	if id != nil {
+		visited := make(map[primitive.ObjectID]bool)
+		for cur := &parentID; cur != nil && !visited[*cur]; cur = tags[*cur].ParentID {
+			if *cur == *id {
+				return false, errors.New("不能把标签移到自己或子标签下")
+			}
+			visited[*cur] = true
+		}
+	}
+
+	return false, nil
+}
+
+// buildTagTree 把标签组装成树, 父标签不存在的作为根节点
+func buildTagTree(list []models.Tag) []models.Tag {
+	children := make(map[primitive.ObjectID][]models.Tag)
+	exists := make(map[primitive.ObjectID]bool, len(list))
+	for _, tag := range list {
+		exists[*tag.ID] = true
+	}
+
+	roots := make([]models.Tag, 0)
+	for _, tag := range list {
+		if tag.ParentID != nil && exists[*tag.ParentID] && *tag.ParentID != *tag.ID {
+			children[*tag.ParentID] = append(children[*tag.ParentID], tag)
+		} else {
+			roots = append(roots, tag)
+		}
+	}
+
+	var attach func(tags []models.Tag, depth int) []models.Tag
+	attach = func(tags []models.Tag, depth int) []models.Tag {
+		if depth > len(list) {
+			return tags
+		}
+		for i := range tags {
+			tags[i].Children = attach(children[*tags[i].ID], depth+1)
+		}
+		return tags
+	}
+
+	return attach(roots, 0)
+}
+
+// ancestors 标签的全部祖先, 由近及远
+func ancestors(tid primitive.ObjectID, tags map[primitive.ObjectID]models.Tag) []primitive.ObjectID {
+	res := make([]primitive.ObjectID, 0)
+	visited := map[primitive.ObjectID]bool{tid: true}
+	for cur := tags[tid].ParentID; cur != nil && !visited[*cur]; cur = tags[*cur].ParentID {
+		visited[*cur] = true
+		res = append(res, *cur)
+	}
+	return res
+}
+
+// descendants 标签及其全部后代, 去重
+func descendants(tids []primitive.ObjectID, tags map[primitive.ObjectID]models.Tag) []primitive.ObjectID {
+	children := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for id, tag := range tags {
+		if tag.ParentID != nil {
+			children[*tag.ParentID] = append(children[*tag.ParentID], id)
+		}
+	}
+
+	res := make([]primitive.ObjectID, 0, len(tids))
+	visited := make(map[primitive.ObjectID]bool)
+	queue := append([]primitive.ObjectID{}, tids...)
+	for len(queue) > 0 {
+		tid := queue[0]
+		queue = queue[1:]
+		if visited[tid] {
+			continue
+		}
+		visited[tid] = true
+		res = append(res, tid)
+		queue = append(queue, children[tid]...)
+	}
+	return res
 }
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestMergeTimer 合并时计时器中的源标签换成目标标签并去重, 保持原有顺序
+func TestMergeTimer(t *testing.T) {
+	source, target, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	tests := []struct {
+		name    string
+		tids    []primitive.ObjectID
+		want    []primitive.ObjectID
+		changed bool
+	}{
+		{"替换", []primitive.ObjectID{other, source}, []primitive.ObjectID{other, target}, true},
+		{"已有目标标签时去重", []primitive.ObjectID{source, other, target}, []primitive.ObjectID{target, other}, true},
+		{"源标签重复出现", []primitive.ObjectID{source, source}, []primitive.ObjectID{target}, true},
+		{"不含源标签", []primitive.ObjectID{other, target}, []primitive.ObjectID{other, target}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := replaceTIDs(tt.tids, source, target)
+			if changed != tt.changed || len(got) != len(tt.want) {
+				t.Fatalf("replaceTIDs = %v, %v, want %v, %v", got, changed, tt.want, tt.changed)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("replaceTIDs = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestMergeGoals 源标签的目标移到目标标签下, 与目标标签已有的同类型同周期目标重复时删除
+func TestMergeGoals(t *testing.T) {
+	source, target := primitive.NewObjectID(), primitive.NewObjectID()
+	goal := func(tid primitive.ObjectID, kind, period string) models.Goal {
+		id := primitive.NewObjectID()
+		return models.Goal{ID: &id, TID: &tid, Kind: &kind, Period: &period}
+	}
+
+	list := []models.Goal{
+		goal(target, models.GoalAtLeast, "week"),
+		goal(source, models.GoalAtLeast, "week"),
+		goal(source, models.GoalAtLeast, "day"),
+		goal(source, models.GoalAtMost, "week"),
+		goal(source, models.GoalAtLeast, "day"),
+	}
+
+	move, drop := splitGoals(list, target)
+	if len(move) != 2 || *list[2].ID != move[0] || *list[3].ID != move[1] {
+		t.Errorf("move = %v", move)
+	}
+	if len(drop) != 2 || *list[1].ID != drop[0] || *list[4].ID != drop[1] {
+		t.Errorf("drop = %v", drop)
+	}
+
+	move, drop = splitGoals(list[:1], target)
+	if len(move) != 0 || len(drop) != 0 {
+		t.Errorf("target only: move = %v, drop = %v", move, drop)
+	}
+}
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// 时间线约定:
+// 带startAt的记录为补录记录, 区间固定为[startAt, endAt], createAt取endAt;
+// 其余为连续记录, 区间为(上一条记录的createAt, createAt], deration随前一条记录变化.
+
+// reflowBatchSize 批量重算时每批写入的记录数
+const reflowBatchSize = 500
+
+// timelineStore 时间线上相邻记录的读写, reflow只通过它访问记录
+type timelineStore interface {
+	// After createAt晚于at的第一条记录, createAt相同时取_id最小的, 没有时返回nil
+	After(ctx context.Context, uid primitive.ObjectID, at time.Time) (*models.Record, error)
+	// Before createAt早于at的最后一条记录, 没有时返回nil
+	Before(ctx context.Context, uid primitive.ObjectID, at time.Time) (*models.Record, error)
+	// SetDeration 更新记录的持续时间
+	SetDeration(ctx context.Context, id primitive.ObjectID, deration time.Duration) error
+}
+
+// mongoTimeline 以记录表实现timelineStore, 须在事务内使用
+type mongoTimeline struct {
+	t *mongo.Collection
+}
+
+// After 实现timelineStore
+func (s *mongoTimeline) After(ctx context.Context, uid primitive.ObjectID, at time.Time) (*models.Record, error) {
+	return s.findOne(ctx, bson.M{
+		"uid":      uid,
+		"createAt": bson.M{"$gt": at},
+	}, bson.D{
+		{Key: "createAt", Value: 1},
+		{Key: "_id", Value: 1},
+	})
+}
+
+// Before 实现timelineStore
+func (s *mongoTimeline) Before(ctx context.Context, uid primitive.ObjectID, at time.Time) (*models.Record, error) {
+	return s.findOne(ctx, bson.M{
+		"uid":      uid,
+		"createAt": bson.M{"$lt": at},
+	}, bson.M{"createAt": -1})
+}
+
+// SetDeration 实现timelineStore
+func (s *mongoTimeline) SetDeration(ctx context.Context, id primitive.ObjectID, deration time.Duration) error {
+	_, err := s.t.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"deration": deration}},
+	)
+	return err
+}
+
+// findOne 按排序取第一条记录, 没有时返回nil
+func (s *mongoTimeline) findOne(ctx context.Context, filter bson.M, sort interface{}) (*models.Record, error) {
+	var record models.Record
+	err := s.t.FindOne(ctx, filter, options.FindOne().SetSort(sort)).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// reflow 重算at之后紧邻的一条连续记录的持续时间, 须在事务内调用
+func (d *App) reflow(ctx context.Context, uid primitive.ObjectID, at time.Time) error {
+	return reflowAfter(ctx, &mongoTimeline{d.mongo.GetColl(models.TRecord)}, uid, at)
+}
+
+// rechain 按前一条记录重算连续记录自身的持续时间, 须在事务内调用
+func (d *App) rechain(ctx context.Context, uid primitive.ObjectID, record *models.Record) error {
+	return rechain(ctx, &mongoTimeline{d.mongo.GetColl(models.TRecord)}, uid, record)
+}
+
+// reflowAfter 重算at之后紧邻的一条连续记录的持续时间
+func reflowAfter(ctx context.Context, s timelineStore, uid primitive.ObjectID, at time.Time) error {
+	next, err := s.After(ctx, uid, at)
+	if err != nil || next == nil {
+		return err
+	}
+
+	// 补录记录的区间是固定的
+	if next.StartAt != nil {
+		return nil
+	}
+	return rechain(ctx, s, uid, next)
+}
+
+// rechain 连续记录的持续时间为与前一条记录createAt的间隔, 没有前一条时为0
+func rechain(ctx context.Context, s timelineStore, uid primitive.ObjectID, record *models.Record) error {
+	prev, err := s.Before(ctx, uid, *record.CreateAt)
+	if err != nil {
+		return err
+	}
+
+	var deration time.Duration
+	if prev != nil {
+		deration = record.CreateAt.Sub(*prev.CreateAt)
+	}
+	return s.SetDeration(ctx, *record.ID, deration)
+}
+
+// chain 按createAt升序遍历时间线, 计算连续记录应有的持续时间
+type chain struct {
+	prev *time.Time // 早于当前记录的最后一个createAt
+	last *time.Time // 上一条记录的createAt
+}
+
+// next 传入下一条记录, 返回其应有的持续时间; 补录记录的区间是固定的, ok为false
+func (c *chain) next(record *models.Record) (deration time.Duration, ok bool) {
+	at := *record.CreateAt
+	// createAt相同的记录以更早的记录为前一条, 与reflow一致
+	if c.last != nil && at.After(*c.last) {
+		c.prev = c.last
+	}
+	c.last = &at
+
+	if record.StartAt != nil {
+		return 0, false
+	}
+	if c.prev != nil {
+		deration = at.Sub(*c.prev)
+	}
+	return deration, true
+}
+
+// past 下一条记录的前一条已晚于to时为true, 此后的记录不受[from, to]内写入的影响, 可以停止遍历
+func (c *chain) past(to time.Time, record *models.Record) bool {
+	return c.last != nil && c.last.After(to) && record.CreateAt.After(*c.last)
+}
+
+// reflowBetween 按时间顺序一次性重算createAt在[at, to]内以及紧随其后的连续记录的持续时间, 只写入有变化的记录, 须在事务内调用
+func (d *App) reflowBetween(ctx context.Context, uid primitive.ObjectID, at, to time.Time) error {
+	t := d.mongo.GetColl(models.TRecord)
+
+	var c chain
+	var prev models.Record
+	err := t.FindOne(ctx, bson.M{
+		"uid":      uid,
+		"createAt": bson.M{"$lt": at},
+	}, options.FindOne().SetSort(bson.M{"createAt": -1})).Decode(&prev)
+	switch err {
+	case nil:
+		c.last = prev.CreateAt
+	case mongo.ErrNoDocuments:
+	default:
+		return err
+	}
+
+	cur, err := t.Find(ctx, bson.M{
+		"uid":      uid,
+		"createAt": bson.M{"$gte": at},
+	}, options.Find().SetSort(bson.D{
+		{Key: "createAt", Value: 1},
+		{Key: "_id", Value: 1},
+	}).SetProjection(bson.M{"createAt": 1, "startAt": 1, "deration": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	writes := make([]mongo.WriteModel, 0, reflowBatchSize)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := t.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+
+	for cur.Next(ctx) {
+		var record models.Record
+		if err := cur.Decode(&record); err != nil {
+			return err
+		}
+		if c.past(to, &record) {
+			break
+		}
+
+		deration, ok := c.next(&record)
+		if !ok || (record.Deration != nil && *record.Deration == deration) {
+			continue
+		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": record.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"deration": deration}}),
+		)
+		if len(writes) == reflowBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// createRecord 写入一条记录, p中带startAt/endAt时为补录记录, 否则接在上一条记录之后
+func (d *App) createRecord(ctx context.Context, uid primitive.ObjectID, p map[string]interface{}) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+
+	startAt, endAt, err := parseInterval(p)
+	if err != nil {
+		return id, err
+	}
+
+	var tids interface{}
+	switch v := p["tid"].(type) {
+	case []interface{}:
+		tids = v
+	case []primitive.ObjectID:
+		tids = v
+	}
+
+	if tids != nil {
+		if err = d.checkArchived(ctx, uid, tids); err != nil {
+			return id, err
+		}
+	}
+
+	t := d.mongo.GetColl(models.TRecord)
+	p["uid"] = uid
+
+	if startAt != nil {
+		// 补录的记录以结束时间作为创建时间, 保证按createAt排序的时间线不被打乱
+		p["startAt"] = *startAt
+		p["endAt"] = *endAt
+		p["createAt"] = *endAt
+		p["deration"] = endAt.Sub(*startAt)
+	} else {
+		now := time.Now().Local()
+		var deration time.Duration
+
+		last := t.FindOne(ctx, bson.M{
+			"uid":      uid,
+			"createAt": bson.M{"$lte": now},
+		}, options.FindOne().SetSort(bson.M{"createAt": -1}))
+		if last.Err() == nil {
+			var record models.Record
+			err = last.Decode(&record)
+			if err == nil {
+				deration = now.Sub(*record.CreateAt)
+			}
+		}
+
+		p["createAt"] = now
+		p["deration"] = deration
+	}
+
+	err = d.mongo.WithTransaction(ctx, func(sc mongo.SessionContext) error {
+		res, err := t.InsertOne(sc, p)
+		if err != nil {
+			return err
+		}
+		id = res.InsertedID.(primitive.ObjectID)
+
+		// 补录记录插入到时间线中间时, 后一条连续记录的时长会变短
+		if startAt != nil {
+			return d.reflow(sc, uid, *endAt)
+		}
+		return nil
+	})
+
+	return id, err
+}
+
+// checkArchived 标签中有已归档的标签时返回错误
+func (d *App) checkArchived(ctx context.Context, uid primitive.ObjectID, tids interface{}) error {
+	archived, err := d.mongo.GetColl(models.TTag).CountDocuments(ctx, bson.M{
+		"uid":      uid,
+		"_id":      bson.M{"$in": tids},
+		"archived": true,
+	})
+	if err != nil {
+		return err
+	}
+	if archived != 0 {
+		return errors.New("不能使用已归档的标签")
+	}
+	return nil
+}
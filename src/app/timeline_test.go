@@ -0,0 +1,348 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestChainImport 在已有的连续记录中插入大量补录记录, 一次遍历的结果须与逐条重算一致
+func TestChainImport(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rnd := rand.New(rand.NewSource(1))
+
+	timeline := make([]models.Record, 0)
+	add := func(at time.Time, explicit bool) {
+		id := primitive.NewObjectID()
+		at = at.Truncate(time.Minute)
+		r := models.Record{ID: &id, CreateAt: &at}
+		if explicit {
+			start := at.Add(-30 * time.Minute)
+			r.StartAt, r.EndAt = &start, &at
+		}
+		timeline = append(timeline, r)
+	}
+
+	// 已有的连续记录
+	for i := 0; i < 2000; i++ {
+		add(base.Add(time.Duration(rnd.Intn(365*24*60))*time.Minute), false)
+	}
+	// 导入的补录记录, 部分与已有记录同一时刻
+	for i := 0; i < 5000; i++ {
+		if i%100 == 0 {
+			add(*timeline[rnd.Intn(2000)].CreateAt, true)
+			continue
+		}
+		add(base.Add(time.Duration(rnd.Intn(365*24*60))*time.Minute), true)
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool {
+		return timeline[i].CreateAt.Before(*timeline[j].CreateAt)
+	})
+
+	// 逐条重算: 前一条为createAt严格更早的最后一条记录
+	want := make([]time.Duration, len(timeline))
+	for i, r := range timeline {
+		for j := i - 1; j >= 0; j-- {
+			if timeline[j].CreateAt.Before(*r.CreateAt) {
+				want[i] = r.CreateAt.Sub(*timeline[j].CreateAt)
+				break
+			}
+		}
+	}
+
+	var c chain
+	for i := range timeline {
+		got, ok := c.next(&timeline[i])
+		if explicit := timeline[i].StartAt != nil; ok == explicit {
+			t.Fatalf("record %d: ok = %v, explicit = %v", i, ok, explicit)
+		}
+		if ok && got != want[i] {
+			t.Fatalf("record %d: deration = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+// TestChainStart 从时间线中间开始遍历时以之前的最后一条记录为起点
+func TestChainStart(t *testing.T) {
+	prev := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	at := prev.Add(90 * time.Minute)
+
+	c := chain{last: &prev}
+	got, ok := c.next(&models.Record{CreateAt: &at})
+	if !ok || got != 90*time.Minute {
+		t.Fatalf("deration = %v, %v, want 1h30m0s, true", got, ok)
+	}
+
+	var empty chain
+	got, ok = empty.next(&models.Record{CreateAt: &at})
+	if !ok || got != 0 {
+		t.Fatalf("first record deration = %v, %v, want 0, true", got, ok)
+	}
+}
+
+// memTimeline 内存中的timelineStore, 查找语义与mongoTimeline一致
+type memTimeline struct {
+	records map[primitive.ObjectID]*models.Record
+}
+
+func newMemTimeline() *memTimeline {
+	return &memTimeline{records: make(map[primitive.ObjectID]*models.Record)}
+}
+
+func (s *memTimeline) After(ctx context.Context, uid primitive.ObjectID, at time.Time) (*models.Record, error) {
+	var res *models.Record
+	for _, r := range s.sorted() {
+		if r.CreateAt.After(at) {
+			res = r
+			break
+		}
+	}
+	return res, nil
+}
+
+func (s *memTimeline) Before(ctx context.Context, uid primitive.ObjectID, at time.Time) (*models.Record, error) {
+	var res *models.Record
+	for _, r := range s.sorted() {
+		if r.CreateAt.Before(at) {
+			res = r
+		}
+	}
+	return res, nil
+}
+
+func (s *memTimeline) SetDeration(ctx context.Context, id primitive.ObjectID, deration time.Duration) error {
+	s.records[id].Deration = &deration
+	return nil
+}
+
+// sorted 按createAt和_id升序排列的记录
+func (s *memTimeline) sorted() []*models.Record {
+	list := make([]*models.Record, 0, len(s.records))
+	for _, r := range s.records {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreateAt.Equal(*list[j].CreateAt) {
+			return list[i].CreateAt.Before(*list[j].CreateAt)
+		}
+		return bytes.Compare(list[i].ID[:], list[j].ID[:]) < 0
+	})
+	return list
+}
+
+// add 加入一条记录, start为nil时为连续记录, 返回其id
+func (s *memTimeline) add(start *time.Time, at time.Time) primitive.ObjectID {
+	id := primitive.NewObjectID()
+	r := &models.Record{ID: &id, CreateAt: &at}
+	if start != nil {
+		r.StartAt, r.EndAt = start, &at
+	}
+	s.records[id] = r
+	return id
+}
+
+// fix 把记录改为补录区间[start, end], 与SetRecord写入的字段一致
+func (s *memTimeline) fix(id primitive.ObjectID, start, end time.Time) {
+	deration := end.Sub(start)
+	r := s.records[id]
+	r.StartAt, r.EndAt, r.CreateAt, r.Deration = &start, &end, &end, &deration
+}
+
+// check 逐条记录的持续时间须与从头遍历整条时间线的结果一致
+func (s *memTimeline) check(t *testing.T) {
+	t.Helper()
+	var c chain
+	for _, r := range s.sorted() {
+		want, ok := c.next(r)
+		if !ok {
+			want = r.EndAt.Sub(*r.StartAt)
+		}
+		if r.Deration == nil || *r.Deration != want {
+			t.Errorf("record at %v: deration = %v, want %v", r.CreateAt.Format("15:04"), r.Deration, want)
+		}
+	}
+}
+
+// newDay 8点到12点每小时一条连续记录, 以及9:10-9:30的一条补录记录
+func newDay(t *testing.T) (s *memTimeline, chained []primitive.ObjectID, fixed primitive.ObjectID) {
+	t.Helper()
+	s = newMemTimeline()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for h := 8; h <= 12; h++ {
+		chained = append(chained, s.add(nil, day.Add(time.Duration(h)*time.Hour)))
+	}
+	start := day.Add(9*time.Hour + 10*time.Minute)
+	fixed = s.add(&start, start.Add(20*time.Minute))
+
+	var c chain
+	for _, r := range s.sorted() {
+		deration, ok := c.next(r)
+		if !ok {
+			deration = r.EndAt.Sub(*r.StartAt)
+		}
+		r.Deration = &deration
+	}
+	s.check(t)
+	return s, chained, fixed
+}
+
+// TestReflowMove 补录记录前后移动越过多条记录, 只重算原位置和新位置之后的一条即可
+func TestReflowMove(t *testing.T) {
+	ctx := context.Background()
+	uid := primitive.NewObjectID()
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		start, end time.Duration
+		chained    bool
+	}{
+		{"向后移过两条记录", 10*time.Hour + 20*time.Minute, 11*time.Hour + 30*time.Minute, false},
+		{"移到最后", 12*time.Hour + 10*time.Minute, 12*time.Hour + 40*time.Minute, false},
+		{"移到最前", 7 * time.Hour, 7*time.Hour + 30*time.Minute, false},
+		{"与连续记录同一时刻", 10 * time.Hour, 11 * time.Hour, false},
+		{"连续记录改为补录", 11*time.Hour + 10*time.Minute, 11*time.Hour + 40*time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, chained, id := newDay(t)
+			if tt.chained {
+				id = chained[2]
+			}
+			old := *s.records[id].CreateAt
+
+			s.fix(id, day.Add(tt.start), day.Add(tt.end))
+			if err := reflowAfter(ctx, s, uid, old); err != nil {
+				t.Fatal(err)
+			}
+			if err := reflowAfter(ctx, s, uid, day.Add(tt.end)); err != nil {
+				t.Fatal(err)
+			}
+			s.check(t)
+		})
+	}
+}
+
+// TestReflowRemove 删除记录后其后的连续记录接到更早的记录上
+func TestReflowRemove(t *testing.T) {
+	ctx := context.Background()
+	uid := primitive.NewObjectID()
+
+	tests := []struct {
+		name  string
+		index int
+		fixed bool
+	}{
+		{"删除两条连续记录之间的记录", 2, false},
+		{"删除第一条", 0, false},
+		{"删除最后一条", 4, false},
+		{"删除补录记录", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, chained, fixed := newDay(t)
+			id := chained[tt.index]
+			if tt.fixed {
+				id = fixed
+			}
+			old := *s.records[id].CreateAt
+
+			delete(s.records, id)
+			if err := reflowAfter(ctx, s, uid, old); err != nil {
+				t.Fatal(err)
+			}
+			s.check(t)
+		})
+	}
+}
+
+// TestRechainUnfix 补录记录转回连续记录后按前一条记录重算自身, 之后的记录不变
+func TestRechainUnfix(t *testing.T) {
+	s, chained, fixed := newDay(t)
+
+	r := s.records[fixed]
+	r.StartAt, r.EndAt = nil, nil
+	if err := rechain(context.Background(), s, primitive.NewObjectID(), r); err != nil {
+		t.Fatal(err)
+	}
+	s.check(t)
+
+	if got := *s.records[fixed].Deration; got != 30*time.Minute {
+		t.Errorf("deration = %v, want 30m0s", got)
+	}
+	if got := *s.records[chained[2]].Deration; got != 30*time.Minute {
+		t.Errorf("next deration = %v, want 30m0s", got)
+	}
+}
+
+// reflowBetween 与App.reflowBetween相同的遍历, 作用于memTimeline
+func (s *memTimeline) reflowBetween(at, to time.Time) {
+	var c chain
+	for _, r := range s.sorted() {
+		if r.CreateAt.Before(at) {
+			c.last = r.CreateAt
+			continue
+		}
+		if c.past(to, r) {
+			break
+		}
+		if deration, ok := c.next(r); ok {
+			r.Deration = &deration
+		}
+	}
+}
+
+// TestReflowBetween 按时间顺序分批导入补录记录, 每批只重算自身范围和紧随其后的记录, 结果与整条时间线重算一致
+func TestReflowBetween(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rnd := rand.New(rand.NewSource(1))
+	s := newMemTimeline()
+
+	var c chain
+	for i := 0; i < 300; i++ {
+		s.add(nil, base.Add(time.Duration(rnd.Intn(30*24*60))*time.Minute))
+	}
+	for _, r := range s.sorted() {
+		deration, _ := c.next(r)
+		r.Deration = &deration
+	}
+	s.check(t)
+
+	imported := make([]time.Time, 0)
+	for i := 0; i < 1000; i++ {
+		at := base.Add(time.Duration(rnd.Intn(30*24*60)) * time.Minute)
+		if i%50 == 0 {
+			// 与已有记录同一时刻
+			at = *s.sorted()[rnd.Intn(300)].CreateAt
+		}
+		imported = append(imported, at)
+	}
+	sort.Slice(imported, func(i, j int) bool {
+		return imported[i].Before(imported[j])
+	})
+
+	const batchSize = 64
+	for i := 0; i < len(imported); i += batchSize {
+		j := i + batchSize
+		if j > len(imported) {
+			j = len(imported)
+		}
+		for _, at := range imported[i:j] {
+			start := at.Add(-20 * time.Minute)
+			deration := 20 * time.Minute
+			id := s.add(&start, at)
+			s.records[id].Deration = &deration
+		}
+		s.reflowBetween(imported[i], imported[j-1])
+	}
+	s.check(t)
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// timerStore 计时器的存储, 每个用户至多一个计时器, 以json保存
+type timerStore interface {
+	// Get 读取计时器, 没有计时时返回nil
+	Get(ctx context.Context, uid primitive.ObjectID) ([]byte, error)
+	// Start 没有计时时保存计时器, 已有计时时返回false
+	Start(ctx context.Context, uid primitive.ObjectID, b []byte) (bool, error)
+	// Claim 取出并删除计时器, 并发调用时只有一个能拿到, 没有计时时返回nil
+	Claim(ctx context.Context, uid primitive.ObjectID) ([]byte, error)
+	// Update 用fn改写计时器, fn返回nil时不改动, 没有计时时不调用fn
+	Update(ctx context.Context, uid primitive.ObjectID, fn func([]byte) ([]byte, error)) error
+}
+
+// redisTimers 以redis保存计时器. 应使用与鉴权令牌不同的库, 互不影响
+type redisTimers struct {
+	rdb *redis.Client
+}
+
+// key 计时器的key
+func (s *redisTimers) key(uid primitive.ObjectID) string {
+	return models.TimerKey + uid.Hex()
+}
+
+// Get 实现timerStore
+func (s *redisTimers) Get(ctx context.Context, uid primitive.ObjectID) ([]byte, error) {
+	b, err := s.rdb.Get(ctx, s.key(uid)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Start 实现timerStore
+func (s *redisTimers) Start(ctx context.Context, uid primitive.ObjectID, b []byte) (bool, error) {
+	return s.rdb.SetNX(ctx, s.key(uid), b, 0).Result()
+}
+
+// Claim 实现timerStore
+func (s *redisTimers) Claim(ctx context.Context, uid primitive.ObjectID) ([]byte, error) {
+	b, err := s.rdb.GetDel(ctx, s.key(uid)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Update 实现timerStore, 计时器在此期间被改动时重试
+func (s *redisTimers) Update(ctx context.Context, uid primitive.ObjectID, fn func([]byte) ([]byte, error)) error {
+	key := s.key(uid)
+	update := func(tx *redis.Tx) error {
+		b, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		b, err = fn(b)
+		if err != nil || b == nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, b, redis.KeepTTL)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for i := 0; i < 3; i++ {
+		if err = s.rdb.Watch(ctx, update, key); err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return err
+}
+
+// startTimer 开始计时, 已有计时时返回错误
+func startTimer(ctx context.Context, store timerStore, uid primitive.ObjectID, timer *models.Timer) error {
+	b, err := json.Marshal(timer)
+	if err != nil {
+		return err
+	}
+
+	ok, err := store.Start(ctx, uid, b)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("已有正在进行的计时")
+	}
+	return nil
+}
+
+// claimTimer 取出计时器交给fn生成记录. 先取出再生成, 并发的停止请求只有一个能拿到; fn失败时放回计时器, 以便修正后重试
+func claimTimer(ctx context.Context, store timerStore, uid primitive.ObjectID, fn func(timer *models.Timer) (primitive.ObjectID, error)) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+
+	b, err := store.Claim(ctx, uid)
+	if err != nil {
+		return id, err
+	}
+	if b == nil {
+		return id, errors.New("当前没有正在进行的计时")
+	}
+
+	var timer models.Timer
+	if err = json.Unmarshal(b, &timer); err == nil {
+		id, err = fn(&timer)
+	}
+	if err != nil {
+		if ok, rerr := store.Start(ctx, uid, b); rerr != nil || !ok {
+			log.Println("放回计时器失败", rerr)
+		}
+		return id, err
+	}
+	return id, nil
+}
+
+// currentTimer 当前计时及已进行的时间, 没有计时时返回nil
+func currentTimer(ctx context.Context, store timerStore, uid primitive.ObjectID, now time.Time) (*models.Timer, error) {
+	b, err := store.Get(ctx, uid)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	var timer models.Timer
+	if err = json.Unmarshal(b, &timer); err != nil {
+		return nil, err
+	}
+	deration := now.Sub(*timer.StartAt)
+	timer.Deration = &deration
+	return &timer, nil
+}
+
+// replaceTimerTag 把正在进行的计时中的源标签换成目标标签
+func replaceTimerTag(ctx context.Context, store timerStore, uid, source, target primitive.ObjectID) error {
+	return store.Update(ctx, uid, func(b []byte) ([]byte, error) {
+		var timer models.Timer
+		if err := json.Unmarshal(b, &timer); err != nil {
+			return nil, err
+		}
+		if timer.TID == nil {
+			return nil, nil
+		}
+		tids, changed := replaceTIDs(*timer.TID, source, target)
+		if !changed {
+			return nil, nil
+		}
+		timer.TID = &tids
+		return json.Marshal(timer)
+	})
+}
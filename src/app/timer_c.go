@@ -0,0 +1,170 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"github.com/NgeKaworu/time-mgt-go/src/parsup"
+	"github.com/NgeKaworu/time-mgt-go/src/resultor"
+	"github.com/julienschmidt/httprouter"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StartTimer 开始计时
+func (d *App) StartTimer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	now := time.Now().Local()
+	timer := models.Timer{StartAt: &now}
+
+	if len(body) != 0 {
+		p, err := parsup.ParSup().ConvJSON(body)
+		if err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		if err = fillTimer(&timer, p); err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+		if startAt, ok := p["startAt"].(time.Time); ok {
+			if startAt.After(now) {
+				resultor.RetFail(w, errors.New("开始时间不能晚于当前时间"))
+				return
+			}
+			timer.StartAt = &startAt
+		}
+	}
+
+	if timer.TID != nil && len(*timer.TID) != 0 {
+		if err = d.checkArchived(context.Background(), uid, *timer.TID); err != nil {
+			resultor.RetFail(w, err)
+			return
+		}
+	}
+
+	if err = startTimer(context.Background(), d.timers, uid, &timer); err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, timer)
+}
+
+// StopTimer 停止计时并生成记录
+func (d *App) StopTimer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	id, err := claimTimer(context.Background(), d.timers, uid, func(timer *models.Timer) (primitive.ObjectID, error) {
+		return d.stopTimer(uid, timer, body)
+	})
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, id.Hex())
+}
+
+// stopTimer 用取出的计时器和停止时的修正生成记录
+func (d *App) stopTimer(uid primitive.ObjectID, timer *models.Timer, body []byte) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+
+	// 停止时可以修正事件和标签
+	if len(body) != 0 {
+		p, err := parsup.ParSup().ConvJSON(body)
+		if err != nil {
+			return id, err
+		}
+		if err = fillTimer(timer, p); err != nil {
+			return id, err
+		}
+	}
+
+	if (timer.TID == nil || len(*timer.TID) == 0) && timer.Event != nil {
+		matched, err := d.autoTag(context.Background(), uid, *timer.Event)
+		if err != nil {
+			return id, err
+		}
+		timer.TID = &matched
+	}
+
+	if timer.TID == nil || len(*timer.TID) == 0 {
+		return id, errors.New("请至少选一个标签")
+	}
+
+	p := map[string]interface{}{
+		"tid":     *timer.TID,
+		"startAt": *timer.StartAt,
+		"endAt":   time.Now().Local(),
+	}
+	if timer.Event != nil {
+		p["event"] = *timer.Event
+	}
+
+	return d.createRecord(context.Background(), uid, p)
+}
+
+// CurrentTimer 当前计时
+func (d *App) CurrentTimer(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	uid, err := primitive.ObjectIDFromHex(r.Header.Get("uid"))
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	timer, err := currentTimer(context.Background(), d.timers, uid, time.Now())
+	if err != nil {
+		resultor.RetFail(w, err)
+		return
+	}
+
+	resultor.RetOk(w, timer)
+}
+
+// fillTimer 用请求参数填充计时器的事件和标签
+func fillTimer(timer *models.Timer, p map[string]interface{}) error {
+	if event, ok := p["event"].(string); ok {
+		timer.Event = &event
+	}
+
+	if tids, ok := p["tid"].([]interface{}); ok {
+		tid := make([]primitive.ObjectID, 0, len(tids))
+		for _, v := range tids {
+			oid, ok := v.(primitive.ObjectID)
+			if !ok {
+				return errors.New("标签id格式错误")
+			}
+			tid = append(tid, oid)
+		}
+		timer.TID = &tid
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memTimers 内存中的timerStore, 语义与redisTimers一致
+type memTimers struct {
+	mu     sync.Mutex
+	timers map[primitive.ObjectID][]byte
+}
+
+func newMemTimers() *memTimers {
+	return &memTimers{timers: make(map[primitive.ObjectID][]byte)}
+}
+
+func (s *memTimers) Get(ctx context.Context, uid primitive.ObjectID) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.timers[uid], nil
+}
+
+func (s *memTimers) Start(ctx context.Context, uid primitive.ObjectID, b []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.timers[uid]; ok {
+		return false, nil
+	}
+	s.timers[uid] = b
+	return true, nil
+}
+
+func (s *memTimers) Claim(ctx context.Context, uid primitive.ObjectID) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.timers[uid]
+	delete(s.timers, uid)
+	return b, nil
+}
+
+func (s *memTimers) Update(ctx context.Context, uid primitive.ObjectID, fn func([]byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.timers[uid]
+	if !ok {
+		return nil
+	}
+	b, err := fn(b)
+	if err != nil || b == nil {
+		return err
+	}
+	s.timers[uid] = b
+	return nil
+}
+
+func TestTimer(t *testing.T) {
+	ctx := context.Background()
+	store := newMemTimers()
+	uid, tid := primitive.NewObjectID(), primitive.NewObjectID()
+	startAt := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	event := "写代码"
+
+	if timer, err := currentTimer(ctx, store, uid, startAt); err != nil || timer != nil {
+		t.Fatalf("current without timer = %v, %v", timer, err)
+	}
+	if _, err := claimTimer(ctx, store, uid, nil); err == nil {
+		t.Fatal("stopping without a timer should fail")
+	}
+
+	timer := &models.Timer{TID: &[]primitive.ObjectID{tid}, Event: &event, StartAt: &startAt}
+	if err := startTimer(ctx, store, uid, timer); err != nil {
+		t.Fatal(err)
+	}
+	if err := startTimer(ctx, store, uid, timer); err == nil {
+		t.Fatal("starting twice should fail")
+	}
+	// 不同用户的计时互不影响
+	if err := startTimer(ctx, store, primitive.NewObjectID(), timer); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := currentTimer(ctx, store, uid, startAt.Add(25*time.Minute))
+	if err != nil || current == nil || *current.Deration != 25*time.Minute || *current.Event != event {
+		t.Fatalf("current = %+v, %v", current, err)
+	}
+
+	// 生成记录失败时放回计时器
+	_, err = claimTimer(ctx, store, uid, func(timer *models.Timer) (primitive.ObjectID, error) {
+		return primitive.NilObjectID, errors.New("不能使用已归档的标签")
+	})
+	if err == nil {
+		t.Fatal("claim should return the create error")
+	}
+	if current, _ = currentTimer(ctx, store, uid, startAt); current == nil || !current.StartAt.Equal(startAt) {
+		t.Fatalf("timer not restored: %+v", current)
+	}
+
+	want := primitive.NewObjectID()
+	id, err := claimTimer(ctx, store, uid, func(timer *models.Timer) (primitive.ObjectID, error) {
+		if (*timer.TID)[0] != tid || !timer.StartAt.Equal(startAt) {
+			t.Errorf("claimed timer = %+v", timer)
+		}
+		return want, nil
+	})
+	if err != nil || id != want {
+		t.Fatalf("claim = %v, %v", id, err)
+	}
+	if current, _ = currentTimer(ctx, store, uid, startAt); current != nil {
+		t.Fatalf("timer left after stop: %+v", current)
+	}
+}
+
+// TestTimerConcurrentStop 并发停止同一个计时只生成一条记录
+func TestTimerConcurrentStop(t *testing.T) {
+	ctx := context.Background()
+	store := newMemTimers()
+	uid := primitive.NewObjectID()
+	startAt := time.Now()
+	if err := startTimer(ctx, store, uid, &models.Timer{StartAt: &startAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	var created int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimTimer(ctx, store, uid, func(timer *models.Timer) (primitive.ObjectID, error) {
+				atomic.AddInt32(&created, 1)
+				return primitive.NewObjectID(), nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("created %d records, want 1", created)
+	}
+}
+
+func TestReplaceTimerTag(t *testing.T) {
+	ctx := context.Background()
+	store := newMemTimers()
+	uid, source, target := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	startAt := time.Now()
+
+	// 没有计时时什么都不做
+	if err := replaceTimerTag(ctx, store, uid, source, target); err != nil {
+		t.Fatal(err)
+	}
+
+	timer := &models.Timer{TID: &[]primitive.ObjectID{source, target}, StartAt: &startAt}
+	if err := startTimer(ctx, store, uid, timer); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceTimerTag(ctx, store, uid, source, target); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := currentTimer(ctx, store, uid, startAt)
+	if err != nil || len(*current.TID) != 1 || (*current.TID)[0] != target {
+		t.Fatalf("timer tags = %v, %v", current.TID, err)
+	}
+}
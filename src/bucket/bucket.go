@@ -0,0 +1,187 @@
+package bucket
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Unit 统计粒度
+type Unit string
+
+const (
+	Hour  Unit = "hour"  // 小时
+	Day   Unit = "day"   // 天
+	Week  Unit = "week"  // 周
+	Month Unit = "month" // 月
+)
+
+// Calendar 按日历粒度切分时间, 边界以Loc时区计算
+type Calendar struct {
+	Unit      Unit
+	Loc       *time.Location
+	WeekStart time.Weekday
+}
+
+// New 工厂方法
+func New(unit Unit, loc *time.Location, weekStart time.Weekday) (*Calendar, error) {
+	switch unit {
+	case Hour, Day, Week, Month:
+	default:
+		return nil, errors.New("不支持的统计粒度")
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Calendar{
+		Unit:      unit,
+		Loc:       loc,
+		WeekStart: weekStart,
+	}, nil
+}
+
+// Floor t所在区间的起点
+func (c *Calendar) Floor(t time.Time) time.Time {
+	t = t.In(c.Loc)
+	y, m, d := t.Date()
+	switch c.Unit {
+	case Hour:
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, c.Loc)
+	case Week:
+		offset := (int(t.Weekday()) - int(c.WeekStart) + 7) % 7
+		return dayStart(y, m, d-offset, c.Loc)
+	case Month:
+		return dayStart(y, m, 1, c.Loc)
+	default:
+		return dayStart(y, m, d, c.Loc)
+	}
+}
+
+// Next 下一个区间的起点, start须为Floor的结果
+func (c *Calendar) Next(start time.Time) time.Time {
+	if c.Unit == Hour {
+		return start.Add(time.Hour)
+	}
+
+	y, m, d := start.In(c.Loc).Date()
+	switch c.Unit {
+	case Week:
+		return dayStart(y, m, d+7, c.Loc)
+	case Month:
+		return dayStart(y, m+1, 1, c.Loc)
+	default:
+		return dayStart(y, m, d+1, c.Loc)
+	}
+}
+
+// dayStart loc时区y-m-d当天的第一个时刻, 超出范围的日和月由time.Date规整.
+// 在零点切换夏令时的时区当天没有零点, time.Date会落到前一天, 此时取切换的时刻
+func dayStart(y int, m time.Month, d int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	noon := time.Date(y, m, d, 12, 0, 0, 0, loc)
+	if t.Day() == noon.Day() {
+		return t
+	}
+	_, before := t.Zone()
+	_, after := noon.Zone()
+	return t.Add(time.Duration(after-before) * time.Second)
+}
+
+// Series [start, end]覆盖的所有区间起点
+func (c *Calendar) Series(start, end time.Time) []time.Time {
+	res := make([]time.Time, 0)
+	for b := c.Floor(start); !b.After(end); b = c.Next(b) {
+		res = append(res, b)
+	}
+	return res
+}
+
+// Count [start, end]覆盖的区间数的估计值, 用于限制请求规模
+func (c *Calendar) Count(start, end time.Time) int {
+	var step time.Duration
+	switch c.Unit {
+	case Hour:
+		step = time.Hour
+	case Week:
+		step = 7 * 24 * time.Hour
+	case Month:
+		step = 28 * 24 * time.Hour
+	default:
+		step = 24 * time.Hour
+	}
+	return int(end.Sub(start)/step) + 1
+}
+
+// Split 把[start, end)按区间切分, 对每段重叠调用fn
+func (c *Calendar) Split(start, end time.Time, fn func(bucket time.Time, d time.Duration)) {
+	for b := c.Floor(start); b.Before(end); {
+		next := c.Next(b)
+
+		from, to := start, end
+		if b.After(from) {
+			from = b
+		}
+		if next.Before(to) {
+			to = next
+		}
+		if to.After(from) {
+			fn(b, to.Sub(from))
+		}
+
+		b = next
+	}
+}
+
+// Previous 紧邻的上一个同长度范围, 范围为整天或整月时按日历平移, 避免大小月和夏令时误差
+func Previous(start, end time.Time, loc *time.Location) (time.Time, time.Time) {
+	endEx := exclusiveEnd(end, loc)
+	tail := endEx.Sub(end)
+
+	if isMidnight(start, loc) && isMidnight(endEx, loc) {
+		s, e := start.In(loc), endEx.In(loc)
+		if s.Day() == 1 && e.Day() == 1 {
+			months := (e.Year()-s.Year())*12 + int(e.Month()-s.Month())
+			return s.AddDate(0, -months, 0), start.Add(-tail)
+		}
+		days := int(math.Round(e.Sub(s).Hours() / 24))
+		return s.AddDate(0, 0, -days), start.Add(-tail)
+	}
+
+	shift := endEx.Sub(start)
+	return start.Add(-shift), end.Add(-shift)
+}
+
+// LastYear 去年同期, 2月29日对应去年的2月28日
+func LastYear(start, end time.Time, loc *time.Location) (time.Time, time.Time) {
+	endEx := exclusiveEnd(end, loc)
+	tail := endEx.Sub(end)
+	// 零点终点不含当天, 2月29日零点即2月28日结束, 对应去年的3月1日零点
+	return lastYear(start, loc, false), lastYear(endEx, loc, isMidnight(endEx, loc)).Add(-tail)
+}
+
+// lastYear t在去年的同一时刻, 2月29日在平年不存在, ceil为true时取3月1日零点, 否则取2月28日
+func lastYear(t time.Time, loc *time.Location, ceil bool) time.Time {
+	t = t.In(loc)
+	res := t.AddDate(-1, 0, 0)
+	if res.Month() != t.Month() && !ceil {
+		res = res.AddDate(0, 0, -res.Day())
+	}
+	return res
+}
+
+// exclusiveEnd 把23:59:59这类闭区间终点规整为次日零点
+func exclusiveEnd(end time.Time, loc *time.Location) time.Time {
+	e := end.In(loc)
+	y, m, d := e.Date()
+	next := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	if next.Sub(e) <= time.Second {
+		return next
+	}
+	return end
+}
+
+// isMidnight 是否为loc时区的零点
+func isMidnight(t time.Time, loc *time.Location) bool {
+	t = t.In(loc)
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
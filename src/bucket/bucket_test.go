@@ -0,0 +1,293 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+)
+
+var cst = time.FixedZone("CST", 8*3600)
+
+// at loc时区的时刻, 超出范围的日和时由time.Date规整
+func at(y int, m time.Month, d, h, min int) time.Time {
+	return time.Date(y, m, d, h, min, 0, 0, cst)
+}
+
+// endOf 当天23:59:59, 前端传来的闭区间终点
+func endOf(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 23, 59, 59, 0, cst)
+}
+
+func TestFloorWeekStart(t *testing.T) {
+	tests := []struct {
+		name      string
+		t         time.Time
+		weekStart time.Weekday
+		want      time.Time
+	}{
+		{"周三, 周一开始", at(2024, 1, 10, 15, 0), time.Monday, at(2024, 1, 8, 0, 0)},
+		{"周三, 周日开始", at(2024, 1, 10, 15, 0), time.Sunday, at(2024, 1, 7, 0, 0)},
+		{"周日, 周一开始", at(2024, 1, 7, 23, 0), time.Monday, at(2024, 1, 1, 0, 0)},
+		{"周日, 周日开始", at(2024, 1, 7, 23, 0), time.Sunday, at(2024, 1, 7, 0, 0)},
+		{"UTC仍是周日, 本地已是周一", time.Date(2024, 1, 7, 17, 0, 0, 0, time.UTC), time.Monday, at(2024, 1, 8, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(Week, cst, tt.weekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.Floor(tt.t); !got.Equal(tt.want) {
+				t.Errorf("Floor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMidnightGap 在零点切换夏令时的时区, 当天从切换时刻开始, Floor和Next不会落回前一天
+func TestMidnightGap(t *testing.T) {
+	// 2018-11-04 圣保罗0点直接跳到1点
+	sp, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skip(err)
+	}
+	gapDay := time.Date(2018, 11, 4, 1, 0, 0, 0, sp)
+
+	for _, unit := range []Unit{Day, Week, Month} {
+		c, err := New(unit, sp, time.Sunday)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.Floor(gapDay.Add(10 * time.Hour)); unit != Month && !got.Equal(gapDay) {
+			t.Errorf("%v: Floor = %v, want %v", unit, got, gapDay)
+		}
+		if got := c.Floor(c.Floor(gapDay)); !got.Equal(c.Floor(gapDay)) {
+			t.Errorf("%v: Floor is not idempotent: %v", unit, got)
+		}
+	}
+
+	c, err := New(Day, sp, time.Sunday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := time.Date(2018, 11, 3, 0, 0, 0, 0, sp)
+	if got := c.Next(prev); !got.Equal(gapDay) {
+		t.Errorf("Next = %v, want %v", got, gapDay)
+	}
+	if got := c.Next(gapDay); !got.Equal(time.Date(2018, 11, 5, 0, 0, 0, 0, sp)) {
+		t.Errorf("Next = %v, want 2018-11-05 00:00", got)
+	}
+
+	got := make(map[time.Time]time.Duration)
+	c.Split(prev, time.Date(2018, 11, 5, 0, 0, 0, 0, sp), func(bucket time.Time, d time.Duration) {
+		got[bucket] += d
+	})
+	if len(got) != 2 || got[prev] != 24*time.Hour || got[gapDay] != 23*time.Hour {
+		t.Errorf("Split = %v, want 24h on 11-03 and 23h on 11-04", got)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	type part struct {
+		bucket time.Time
+		d      time.Duration
+	}
+
+	tests := []struct {
+		name       string
+		unit       Unit
+		weekStart  time.Weekday
+		start, end time.Time
+		want       []part
+	}{
+		{
+			name:  "跨小时",
+			unit:  Hour,
+			start: at(2024, 1, 10, 9, 30), end: at(2024, 1, 10, 11, 15),
+			want: []part{
+				{at(2024, 1, 10, 9, 0), 30 * time.Minute},
+				{at(2024, 1, 10, 10, 0), time.Hour},
+				{at(2024, 1, 10, 11, 0), 15 * time.Minute},
+			},
+		},
+		{
+			name:  "跨零点",
+			unit:  Day,
+			start: at(2024, 1, 10, 22, 0), end: at(2024, 1, 11, 2, 0),
+			want: []part{
+				{at(2024, 1, 10, 0, 0), 2 * time.Hour},
+				{at(2024, 1, 11, 0, 0), 2 * time.Hour},
+			},
+		},
+		{
+			name:  "恰好在零点结束",
+			unit:  Day,
+			start: at(2024, 1, 10, 22, 0), end: at(2024, 1, 11, 0, 0),
+			want: []part{{at(2024, 1, 10, 0, 0), 2 * time.Hour}},
+		},
+		{
+			name:      "跨周, 周一开始",
+			unit:      Week,
+			weekStart: time.Monday,
+			start:     at(2024, 1, 7, 20, 0), end: at(2024, 1, 8, 4, 0),
+			want: []part{
+				{at(2024, 1, 1, 0, 0), 4 * time.Hour},
+				{at(2024, 1, 8, 0, 0), 4 * time.Hour},
+			},
+		},
+		{
+			name:      "同一时段周日开始时不跨周",
+			unit:      Week,
+			weekStart: time.Sunday,
+			start:     at(2024, 1, 7, 20, 0), end: at(2024, 1, 8, 4, 0),
+			want: []part{{at(2024, 1, 7, 0, 0), 8 * time.Hour}},
+		},
+		{
+			name:      "跨周, 周日开始",
+			unit:      Week,
+			weekStart: time.Sunday,
+			start:     at(2024, 1, 6, 22, 0), end: at(2024, 1, 7, 1, 0),
+			want: []part{
+				{at(2023, 12, 31, 0, 0), 2 * time.Hour},
+				{at(2024, 1, 7, 0, 0), time.Hour},
+			},
+		},
+		{
+			name:  "跨月",
+			unit:  Month,
+			start: at(2024, 1, 31, 22, 0), end: at(2024, 2, 1, 3, 0),
+			want: []part{
+				{at(2024, 1, 1, 0, 0), 2 * time.Hour},
+				{at(2024, 2, 1, 0, 0), 3 * time.Hour},
+			},
+		},
+		{
+			name:  "跨年",
+			unit:  Month,
+			start: at(2023, 12, 31, 23, 0), end: at(2024, 1, 1, 1, 0),
+			want: []part{
+				{at(2023, 12, 1, 0, 0), time.Hour},
+				{at(2024, 1, 1, 0, 0), time.Hour},
+			},
+		},
+		{
+			name:  "空区间",
+			unit:  Day,
+			start: at(2024, 1, 10, 9, 0), end: at(2024, 1, 10, 9, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.unit, cst, tt.weekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]part, 0)
+			c.Split(tt.start, tt.end, func(bucket time.Time, d time.Duration) {
+				got = append(got, part{bucket, d})
+			})
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Split = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].bucket.Equal(tt.want[i].bucket) || got[i].d != tt.want[i].d {
+					t.Errorf("part %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	tests := []struct {
+		name               string
+		start, end         time.Time
+		wantStart, wantEnd time.Time
+	}{
+		{
+			name:  "周",
+			start: at(2024, 1, 8, 0, 0), end: endOf(2024, 1, 14),
+			wantStart: at(2024, 1, 1, 0, 0), wantEnd: endOf(2024, 1, 7),
+		},
+		{
+			name:  "大月的上一个月是闰年二月",
+			start: at(2024, 3, 1, 0, 0), end: endOf(2024, 3, 31),
+			wantStart: at(2024, 2, 1, 0, 0), wantEnd: endOf(2024, 2, 29),
+		},
+		{
+			name:  "小月的上一个月是大月",
+			start: at(2024, 4, 1, 0, 0), end: endOf(2024, 4, 30),
+			wantStart: at(2024, 3, 1, 0, 0), wantEnd: endOf(2024, 3, 31),
+		},
+		{
+			name:  "终点为次月零点",
+			start: at(2024, 3, 1, 0, 0), end: at(2024, 4, 1, 0, 0),
+			wantStart: at(2024, 2, 1, 0, 0), wantEnd: at(2024, 3, 1, 0, 0),
+		},
+		{
+			name:  "整天",
+			start: at(2024, 3, 10, 0, 0), end: endOf(2024, 3, 12),
+			wantStart: at(2024, 3, 7, 0, 0), wantEnd: endOf(2024, 3, 9),
+		},
+		{
+			name:  "非整天按时长平移",
+			start: at(2024, 3, 10, 9, 0), end: at(2024, 3, 10, 11, 30),
+			wantStart: at(2024, 3, 10, 6, 30), wantEnd: at(2024, 3, 10, 9, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := Previous(tt.start, tt.end, cst)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("Previous = %v ~ %v, want %v ~ %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestLastYear(t *testing.T) {
+	tests := []struct {
+		name               string
+		start, end         time.Time
+		wantStart, wantEnd time.Time
+	}{
+		{
+			name:  "2月29日对应2月28日",
+			start: at(2024, 2, 29, 0, 0), end: endOf(2024, 2, 29),
+			wantStart: at(2023, 2, 28, 0, 0), wantEnd: endOf(2023, 2, 28),
+		},
+		{
+			name:  "2月29日的时段",
+			start: at(2024, 2, 29, 9, 0), end: at(2024, 2, 29, 12, 0),
+			wantStart: at(2023, 2, 28, 9, 0), wantEnd: at(2023, 2, 28, 12, 0),
+		},
+		{
+			name:  "闰年二月对应整个平年二月",
+			start: at(2024, 2, 1, 0, 0), end: endOf(2024, 2, 29),
+			wantStart: at(2023, 2, 1, 0, 0), wantEnd: endOf(2023, 2, 28),
+		},
+		{
+			name:  "终点为2月29日零点",
+			start: at(2024, 2, 1, 0, 0), end: at(2024, 2, 29, 0, 0),
+			wantStart: at(2023, 2, 1, 0, 0), wantEnd: at(2023, 3, 1, 0, 0),
+		},
+		{
+			name:  "普通日期",
+			start: at(2024, 3, 10, 0, 0), end: endOf(2024, 3, 10),
+			wantStart: at(2023, 3, 10, 0, 0), wantEnd: endOf(2023, 3, 10),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := LastYear(tt.start, tt.end, cst)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("LastYear = %v ~ %v, want %v ~ %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
@@ -73,6 +73,8 @@ func (d *MongoClient) Open(mg, mdb string, initdb bool) error {
 			{Keys: bsonx.Doc{bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)}}},
 			{Keys: bsonx.Doc{bsonx.Elem{Key: "tid", Value: bsonx.Int32(1)}}},
 			{Keys: bsonx.Doc{bsonx.Elem{Key: "createAt", Value: bsonx.Int32(-1)}}},
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "event", Value: bsonx.String("text")}},
+				Options: options.Index().SetDefaultLanguage("none")},
 		})
 
 		if err != nil {
@@ -90,6 +92,71 @@ func (d *MongoClient) Open(mg, mdb string, initdb bool) error {
 				bsonx.Elem{Key: "name", Value: bsonx.Int32(1)},
 			}, Options: options.Index().SetUnique(true)},
 			{Keys: bsonx.Doc{bsonx.Elem{Key: "createAt", Value: bsonx.Int32(-1)}}},
+			{Keys: bsonx.Doc{
+				bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)},
+				bsonx.Elem{Key: "sort", Value: bsonx.Int32(1)},
+			}},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+		// 标签分组表
+		group := session.Database(mdb).Collection(models.TTagGroup)
+		indexView = group.Indexes()
+		_, err = indexView.CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bsonx.Doc{
+				bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)},
+				bsonx.Elem{Key: "name", Value: bsonx.Int32(1)},
+			}, Options: options.Index().SetUnique(true)},
+			{Keys: bsonx.Doc{
+				bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)},
+				bsonx.Elem{Key: "sort", Value: bsonx.Int32(1)},
+			}},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+		// 规则表
+		rule := session.Database(mdb).Collection(models.TRule)
+		indexView = rule.Indexes()
+		_, err = indexView.CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)}}},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+		// 目标表
+		goal := session.Database(mdb).Collection(models.TGoal)
+		indexView = goal.Indexes()
+		_, err = indexView.CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)}}},
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "tid", Value: bsonx.Int32(1)}}},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+		// 偏好表
+		preference := session.Database(mdb).Collection(models.TPreference)
+		indexView = preference.Indexes()
+		_, err = indexView.CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)}},
+				Options: options.Index().SetUnique(true)},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+
+		// 日历订阅表
+		feed := session.Database(mdb).Collection(models.TFeed)
+		indexView = feed.Indexes()
+		_, err = indexView.CreateMany(context.Background(), []mongo.IndexModel{
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "uid", Value: bsonx.Int32(1)}}},
+			{Keys: bsonx.Doc{bsonx.Elem{Key: "hash", Value: bsonx.Int32(1)}},
+				Options: options.Index().SetUnique(true)},
 		})
 		if err != nil {
 			log.Println(err)
@@ -106,6 +173,24 @@ func (d *MongoClient) GetColl(coll string) *mongo.Collection {
 	return col
 }
 
+// WithTransaction 在事务中执行fn, fn内的操作须使用传入的SessionContext.
+// 事务要求mongod以副本集(replica set)方式运行, 单机部署也须以单节点副本集启动
+// (mongod --replSet rs0 后执行一次 rs.initiate(), 连接串带上 ?replicaSet=rs0),
+// 否则记录的增删改、导入和合并标签等都会报
+// "Transaction numbers are only allowed on a replica set member or mongos"
+func (d *MongoClient) WithTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := d.MgEngine.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
 // Close 关闭连接池
 func (d *MongoClient) Close() {
 	d.MgEngine.Disconnect(context.Background())
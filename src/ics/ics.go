@@ -0,0 +1,108 @@
+package ics
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// lineLimit 每行最多的字节数(不含换行), 超出的部分折行
+const lineLimit = 75
+
+// stampLayout UTC时间格式
+const stampLayout = "20060102T150405Z"
+
+// Event 日历中的一个事件
+type Event struct {
+	UID        string    // 唯一标识
+	Start      time.Time // 开始时间
+	End        time.Time // 结束时间, 不晚于开始时间时省略
+	Stamp      time.Time // 最后修改时间
+	Summary    string    // 标题
+	Categories []string  // 分类
+}
+
+// Writer 流式写入iCalendar(RFC 5545)
+type Writer struct {
+	w   *bufio.Writer
+	err error
+}
+
+// NewWriter 工厂方法, 写入日历头
+func NewWriter(w io.Writer, name string) *Writer {
+	c := &Writer{w: bufio.NewWriter(w)}
+	c.line("BEGIN", "VCALENDAR")
+	c.line("VERSION", "2.0")
+	c.line("PRODID", "-//NgeKaworu//time-mgt-go//CN")
+	c.line("CALSCALE", "GREGORIAN")
+	c.line("METHOD", "PUBLISH")
+	c.line("X-WR-CALNAME", Escape(name))
+	return c
+}
+
+// WriteEvent 写入一个VEVENT
+func (c *Writer) WriteEvent(e Event) error {
+	c.line("BEGIN", "VEVENT")
+	c.line("UID", Escape(e.UID))
+	c.line("DTSTAMP", e.Stamp.UTC().Format(stampLayout))
+	c.line("DTSTART", e.Start.UTC().Format(stampLayout))
+	if e.End.After(e.Start) {
+		c.line("DTEND", e.End.UTC().Format(stampLayout))
+	}
+	c.line("SUMMARY", Escape(e.Summary))
+	if len(e.Categories) != 0 {
+		categories := make([]string, 0, len(e.Categories))
+		for _, category := range e.Categories {
+			categories = append(categories, Escape(category))
+		}
+		c.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	c.line("END", "VEVENT")
+	return c.err
+}
+
+// Close 写入日历尾并输出缓冲的内容
+func (c *Writer) Close() error {
+	c.line("END", "VCALENDAR")
+	if c.err != nil {
+		return c.err
+	}
+	return c.w.Flush()
+}
+
+// line 写入一行内容, 超过lineLimit字节时折行, 不会拆开多字节字符
+func (c *Writer) line(name, value string) {
+	if c.err != nil {
+		return
+	}
+
+	s := name + ":" + value
+	limit := lineLimit
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		if _, c.err = c.w.WriteString(s[:i] + "\r\n "); c.err != nil {
+			return
+		}
+		s = s[i:]
+		// 续行以空格开头, 占去一个字节
+		limit = lineLimit - 1
+	}
+	_, c.err = c.w.WriteString(s + "\r\n")
+}
+
+// Escape 转义TEXT类型的值
+func Escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
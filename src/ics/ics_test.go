@@ -0,0 +1,155 @@
+package ics
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"写代码", "写代码"},
+		{"a;b", `a\;b`},
+		{"a,b", `a\,b`},
+		{`C:\dir`, `C:\\dir`},
+		{"line1\nline2", `line1\nline2`},
+		{"line1\r\nline2", `line1\nline2`},
+		{"line1\rline2", `line1\nline2`},
+		{`\;,`, `\\\;\,`},
+	}
+	for _, tt := range tests {
+		if got := Escape(tt.in); got != tt.want {
+			t.Errorf("Escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// physicalLines 按CRLF拆分输出, 最后一行须以CRLF结尾
+func physicalLines(t *testing.T, out string) []string {
+	t.Helper()
+	if !strings.HasSuffix(out, "\r\n") {
+		t.Fatalf("output does not end with CRLF: %q", out)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+	for _, l := range lines {
+		if strings.ContainsAny(l, "\r\n") {
+			t.Fatalf("bare CR or LF in line %q", l)
+		}
+	}
+	return lines
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"恰好75字节不折行", strings.Repeat("a", lineLimit-len("SUMMARY:"))},
+		{"76字节折成两行", strings.Repeat("a", lineLimit-len("SUMMARY:")+1)},
+		{"长ASCII", strings.Repeat("0123456789", 30)},
+		{"中文", strings.Repeat("时间管理", 40)},
+		{"中文与ASCII错位", "x" + strings.Repeat("时间管理", 40)},
+		{"四字节字符", "xy" + strings.Repeat("😀", 50)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			c := &Writer{w: bufio.NewWriter(&buf)}
+			c.line("SUMMARY", tt.value)
+			if err := c.w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := physicalLines(t, buf.String())
+			var unfolded strings.Builder
+			for i, l := range lines {
+				if len(l) > lineLimit {
+					t.Errorf("line %d has %d octets: %q", i, len(l), l)
+				}
+				if i > 0 {
+					if !strings.HasPrefix(l, " ") {
+						t.Fatalf("continuation line %d does not start with a space: %q", i, l)
+					}
+					l = l[1:]
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d splits a rune: %q", i, l)
+				}
+				unfolded.WriteString(l)
+			}
+
+			if want := "SUMMARY:" + tt.value; unfolded.String() != want {
+				t.Errorf("unfolded = %q, want %q", unfolded.String(), want)
+			}
+			if n := len("SUMMARY:" + tt.value); n <= lineLimit && len(lines) != 1 {
+				t.Errorf("%d octets folded into %d lines", n, len(lines))
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	start := time.Date(2024, 1, 15, 9, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	long := strings.Repeat("a", 100)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, "我的, 日历")
+	err := w.WriteEvent(Event{
+		UID:        "1@time-mgt",
+		Start:      start,
+		End:        start.Add(90 * time.Minute),
+		Stamp:      start.Add(2 * time.Hour),
+		Summary:    "写代码; 评审",
+		Categories: []string{"工作", "a,b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有结束时间时省略DTEND
+	err = w.WriteEvent(Event{
+		UID:     "2@time-mgt",
+		Start:   start,
+		End:     start,
+		Stamp:   start,
+		Summary: long,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"PRODID:-//NgeKaworu//time-mgt-go//CN\r\n" +
+		"CALSCALE:GREGORIAN\r\n" +
+		"METHOD:PUBLISH\r\n" +
+		"X-WR-CALNAME:我的\\, 日历\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:1@time-mgt\r\n" +
+		"DTSTAMP:20240115T030000Z\r\n" +
+		"DTSTART:20240115T010000Z\r\n" +
+		"DTEND:20240115T023000Z\r\n" +
+		"SUMMARY:写代码\\; 评审\r\n" +
+		"CATEGORIES:工作,a\\,b\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:2@time-mgt\r\n" +
+		"DTSTAMP:20240115T010000Z\r\n" +
+		"DTSTART:20240115T010000Z\r\n" +
+		"SUMMARY:" + long[:67] + "\r\n" +
+		" " + long[67:] + "\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	if got := buf.String(); got != want {
+		t.Errorf("output mismatch\n got: %q\nwant: %q", got, want)
+	}
+}
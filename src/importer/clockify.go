@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// clockifyName Clockify中的项目或标签, 兼容名称字符串和带name/color的对象
+type clockifyName struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// UnmarshalJSON 实现json.Unmarshaler
+func (n *clockifyName) UnmarshalJSON(b []byte) error {
+	if strings.HasPrefix(string(b), `"`) {
+		return json.Unmarshal(b, &n.Name)
+	}
+	type plain clockifyName
+	return json.Unmarshal(b, (*plain)(n))
+}
+
+// clockifyEntry Clockify导出的时间条目, 兼容API(带hydrated信息)和详细报表两种json
+type clockifyEntry struct {
+	Description  string         `json:"description"`
+	Project      *clockifyName  `json:"project"`      // API
+	ProjectName  string         `json:"projectName"`  // 报表
+	ProjectColor string         `json:"projectColor"` // 报表
+	Tags         []clockifyName `json:"tags"`
+	TimeInterval struct {
+		Start    string        `json:"start"`
+		End      string        `json:"end"`
+		Duration durationValue `json:"duration"` // API为PT1H30M格式, 报表为秒数
+	} `json:"timeInterval"`
+}
+
+// ParseClockify 解析Clockify导出的csv或json, 项目和标签都转为标签, 项目带颜色
+func ParseClockify(r io.Reader, loc *time.Location) (*Result, error) {
+	br, isJSON := sniffJSON(r)
+	if !isJSON {
+		return parseClockifyCSV(br, loc)
+	}
+
+	var entries []clockifyEntry
+	if err := decodeEntries(br, &entries, "timeentries", "timeEntries"); err != nil {
+		return nil, err
+	}
+	if len(entries) > MaxRows {
+		return nil, errors.New("单次导入的行数过多")
+	}
+
+	res := newResult()
+	for i, e := range entries {
+		line := i + 1
+		res.Total++
+
+		project, color := e.ProjectName, e.ProjectColor
+		if e.Project != nil {
+			project, color = firstOf(project, e.Project.Name), firstOf(color, e.Project.Color)
+		}
+		res.color(project, color)
+
+		if e.TimeInterval.End == "" {
+			res.fail(line, "end", "计时尚未结束")
+			continue
+		}
+
+		tags := make([]string, 0, len(e.Tags))
+		for _, tag := range e.Tags {
+			tags = append(tags, tag.Name)
+			res.color(tag.Name, tag.Color)
+		}
+
+		res.add(line, firstOf(e.Description, project), joinTags(project, tags),
+			e.TimeInterval.Start, e.TimeInterval.End, string(e.TimeInterval.Duration), loc)
+	}
+	return res, nil
+}
+
+// parseClockifyCSV 解析Clockify详细报表导出的csv, 日期和时间分两列
+func parseClockifyCSV(r io.Reader, loc *time.Location) (*Result, error) {
+	res := newResult()
+	err := eachRow(r, res, []string{"Description", "Start Date", "Start Time"}, func(line int, cell func(names ...string) string) {
+		project := cell("Project")
+		res.add(line, firstOf(cell("Description"), project), joinTags(project, strings.Split(cell("Tags"), ",")),
+			dateTime(cell("Start Date"), cell("Start Time")),
+			dateTime(cell("End Date"), cell("End Time")),
+			cell("Duration (h)", "Duration"), loc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseClockifyCSV(t *testing.T) {
+	in := "Project,Client,Description,Task,User,Group,Email,Tags,Billable,Start Date,Start Time,End Date,End Time,Duration (h),Duration (decimal)\n" +
+		"Work,,Sync,,Ann,,ann@example.com,\"team, sync\",No,01/15/2024,09:00:00 AM,01/15/2024,10:15:00 AM,01:15:00,1.25\n" +
+		"Work,,Lunch talk,,Ann,,ann@example.com,,No,01/15/2024,12:00:00 PM,01/15/2024,12:45:00 PM,00:45:00,0.75\n" +
+		"Life,,Late,,Ann,,ann@example.com,,No,01/15/2024,11:30:00 PM,01/16/2024,12:30:00 AM,01:00:00,1.00\n"
+
+	loc := time.FixedZone("CST", 8*3600)
+	res, err := ParseClockify(strings.NewReader(in), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || len(res.Entries) != 3 {
+		t.Fatalf("total = %d, entries = %+v, errors = %+v", res.Total, res.Entries, res.Errors)
+	}
+
+	tests := []struct {
+		event      string
+		tags       string
+		start, end time.Time
+	}{
+		{"Sync", "Work|team|sync", time.Date(2024, 1, 15, 9, 0, 0, 0, loc), time.Date(2024, 1, 15, 10, 15, 0, 0, loc)},
+		{"Lunch talk", "Work", time.Date(2024, 1, 15, 12, 0, 0, 0, loc), time.Date(2024, 1, 15, 12, 45, 0, 0, loc)},
+		{"Late", "Life", time.Date(2024, 1, 15, 23, 30, 0, 0, loc), time.Date(2024, 1, 16, 0, 30, 0, 0, loc)},
+	}
+	for i, want := range tests {
+		e := res.Entries[i]
+		if e.Event != want.event || strings.Join(e.Tags, "|") != want.tags ||
+			!e.StartAt.Equal(want.start) || !e.EndAt.Equal(want.end) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want)
+		}
+	}
+}
+
+func TestParseClockifyJSON(t *testing.T) {
+	// API导出, 项目和标签为对象, 第二条仍在计时
+	api := `[
+		{"description": "Sync", "project": {"name": "Work", "color": "#03a9f4"},
+		 "tags": [{"name": "team", "color": "#ff0000"}],
+		 "timeInterval": {"start": "2024-01-15T01:00:00Z", "end": "2024-01-15T02:30:00Z", "duration": "PT1H30M"}},
+		{"description": "Running", "projectName": "Work",
+		 "timeInterval": {"start": "2024-01-15T03:00:00Z", "end": null, "duration": null}}
+	]`
+	res, err := ParseClockify(strings.NewReader(api), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 || len(res.Entries) != 1 || len(res.Errors) != 1 || res.Errors[0].Field != "end" {
+		t.Fatalf("total = %d, entries = %+v, errors = %+v", res.Total, res.Entries, res.Errors)
+	}
+	e := res.Entries[0]
+	if e.Event != "Sync" || strings.Join(e.Tags, "|") != "Work|team" || e.EndAt.Sub(e.StartAt) != 90*time.Minute {
+		t.Errorf("entry = %+v", e)
+	}
+	if res.Colors["Work"] != "#03a9f4" || res.Colors["team"] != "#ff0000" {
+		t.Errorf("colors = %v", res.Colors)
+	}
+
+	// 详细报表导出, 条目在timeentries中, 时长为秒数
+	report := `{"totals": [], "timeentries": [
+		{"description": "", "projectName": "Reading", "projectColor": "#8bc34a", "tags": ["book"],
+		 "timeInterval": {"start": "2024-01-15T20:00:00+08:00", "end": "2024-01-15T21:00:00+08:00", "duration": 3600}}
+	]}`
+	res, err = ParseClockify(strings.NewReader(report), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Entries) != 1 {
+		t.Fatalf("entries = %+v, errors = %+v", res.Entries, res.Errors)
+	}
+	e = res.Entries[0]
+	if e.Event != "Reading" || strings.Join(e.Tags, "|") != "Reading|book" || !e.StartAt.Equal(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("entry = %+v", e)
+	}
+	if res.Colors["Reading"] != "#8bc34a" {
+		t.Errorf("colors = %v", res.Colors)
+	}
+}
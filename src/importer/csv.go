@@ -0,0 +1,150 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// Mapping csv列名映射, 列名不区分大小写, 为空表示没有这一列
+type Mapping struct {
+	Start        string // 开始时间列
+	End          string // 结束时间列
+	Duration     string // 时长列
+	Event        string // 事件列
+	Tags         string // 标签列
+	TagSeparator string // 标签列中多个标签名的分隔符
+}
+
+// DefaultMapping 默认映射, 与导出的csv一致
+func DefaultMapping() Mapping {
+	return Mapping{
+		Start:        "start",
+		End:          "end",
+		Duration:     "duration",
+		Event:        "event",
+		Tags:         "tags",
+		TagSeparator: ";",
+	}
+}
+
+// ParseCSV 解析通用csv, 第一行为表头; 文件本身有问题时返回error, 行内错误记录在Result.Errors
+func ParseCSV(r io.Reader, m Mapping, loc *time.Location) (*Result, error) {
+	if m.Event == "" {
+		return nil, errors.New("须指定事件列")
+	}
+
+	sep := m.TagSeparator
+	if sep == "" {
+		sep = DefaultMapping().TagSeparator
+	}
+
+	required := make([]string, 0, 5)
+	for _, name := range []string{m.Start, m.End, m.Duration, m.Event, m.Tags} {
+		if name != "" {
+			required = append(required, name)
+		}
+	}
+
+	// 只有本系统导出的文件才去掉防公式执行的单引号, 其它来源的单引号是原有内容
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(exportHeader))
+	text := func(s string) string { return s }
+	if string(head) == exportHeader {
+		text = unquoteFormula
+	}
+
+	res := newResult()
+	err := eachRow(br, res, required, func(line int, cell func(names ...string) string) {
+		res.add(line, text(cell(m.Event)), splitTags(text(cell(m.Tags)), sep),
+			cell(m.Start), cell(m.End), cell(m.Duration), loc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// exportHeader 导出记录的csv开头(BOM和表头), 与导出接口一致
+const exportHeader = "\xEF\xBB\xBFid,start,end,duration,event,tags\n"
+
+// unquoteFormula 去掉导出时加在公式字符前的单引号, 使导出的文件可以原样导入
+func unquoteFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// eachRow 逐行读取带表头的csv, 表头缺少required中的列时返回error.
+// cell按列名(不区分大小写)取值, 传多个列名时取第一个存在的列, 都不存在时为空串
+func eachRow(r io.Reader, res *Result, required []string, fn func(line int, cell func(names ...string) string)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return errors.New("文件为空")
+	}
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\xEF\xBB\xBF")
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range required {
+		if _, ok := index[strings.ToLower(strings.TrimSpace(name))]; !ok {
+			return errors.New("找不到列: " + name)
+		}
+	}
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		res.Total++
+		if res.Total > MaxRows {
+			return errors.New("单次导入的行数过多")
+		}
+
+		if err != nil {
+			// 引号不匹配等行内格式错误不影响其它行
+			if pe, ok := err.(*csv.ParseError); ok {
+				res.fail(pe.StartLine, "", pe.Err.Error())
+				continue
+			}
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+
+		fn(line, func(names ...string) string {
+			for _, name := range names {
+				if name == "" {
+					continue
+				}
+				i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+				if !ok {
+					continue
+				}
+				if i < len(row) {
+					return strings.TrimSpace(row[i])
+				}
+				return ""
+			}
+			return ""
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCSVMany(t *testing.T) {
+	const rows = 20000
+	start := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	var b strings.Builder
+	b.WriteString("\xEF\xBB\xBFid,start,end,duration,event,tags\n")
+	for i := 0; i < rows; i++ {
+		s := start.Add(time.Duration(i) * time.Hour)
+		fmt.Fprintf(&b, "%d,%s,,45m,事件%d,工作;项目%d\n", i, s.Format(time.RFC3339), i, i%7)
+	}
+
+	res, err := ParseCSV(strings.NewReader(b.String()), DefaultMapping(), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != rows || len(res.Entries) != rows || len(res.Errors) != 0 {
+		t.Fatalf("total = %d, entries = %d, errors = %v", res.Total, len(res.Entries), res.Errors)
+	}
+
+	last := res.Entries[rows-1]
+	if last.Line != rows+1 {
+		t.Errorf("last line = %d, want %d", last.Line, rows+1)
+	}
+	if want := start.Add((rows-1)*time.Hour + 45*time.Minute); !last.EndAt.Equal(want) {
+		t.Errorf("last end = %v, want %v", last.EndAt, want)
+	}
+	if got := strings.Join(last.Tags, "|"); got != fmt.Sprintf("工作|项目%d", (rows-1)%7) {
+		t.Errorf("last tags = %q", got)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	in := "开始,结束,事件,标签\n" +
+		"2024-01-15 09:00,2024-01-15 10:30,写代码,\" 工作 / 编程 / 工作 \"\n" +
+		"2024-01-15 11:00,2024-01-15 10:00,倒序,工作\n" +
+		",2024-01-15 12:00,缺少开始,工作\n" +
+		"2024-01-15 13:00,2024-01-15 14:00,,工作\n"
+	m := Mapping{Start: "开始", End: "结束", Event: "事件", Tags: "标签", TagSeparator: "/"}
+
+	loc := time.FixedZone("CST", 8*3600)
+	res, err := ParseCSV(strings.NewReader(in), m, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 4 || len(res.Entries) != 1 {
+		t.Fatalf("total = %d, entries = %d", res.Total, len(res.Entries))
+	}
+
+	e := res.Entries[0]
+	if e.Line != 2 || e.Event != "写代码" || strings.Join(e.Tags, "|") != "工作|编程" {
+		t.Errorf("entry = %+v", e)
+	}
+	if want := time.Date(2024, 1, 15, 1, 0, 0, 0, time.UTC); !e.StartAt.Equal(want) {
+		t.Errorf("start = %v, want %v", e.StartAt, want)
+	}
+
+	wantErrors := []struct {
+		line  int
+		field string
+	}{{3, "end"}, {4, "duration"}, {5, "event"}}
+	if len(res.Errors) != len(wantErrors) {
+		t.Fatalf("errors = %v", res.Errors)
+	}
+	for i, want := range wantErrors {
+		if got := res.Errors[i]; got.Line != want.line || got.Field != want.field {
+			t.Errorf("error %d = %+v, want line %d field %s", i, got, want.line, want.field)
+		}
+	}
+
+	if _, err := ParseCSV(strings.NewReader(in), DefaultMapping(), loc); err == nil {
+		t.Error("missing columns should fail")
+	}
+}
+
+// TestParseCSVFormula 导出时为防止公式执行加的单引号只在导入本系统导出的文件时去掉
+func TestParseCSVFormula(t *testing.T) {
+	rows := "1,2024-01-15 09:00,2024-01-15 10:00,1h,'=SUM(A1),'@工作;编程\n" +
+		"2,2024-01-15 10:00,2024-01-15 11:00,1h,'引号开头,工作\n"
+
+	tests := []struct {
+		name  string
+		in    string
+		event string
+		tags  string
+	}{
+		{"本系统导出", "\xEF\xBB\xBFid,start,end,duration,event,tags\n" + rows, "=SUM(A1)", "@工作|编程"},
+		{"其它来源", "id,start,end,duration,event,tags\n" + rows, "'=SUM(A1)", "'@工作|编程"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ParseCSV(strings.NewReader(tt.in), DefaultMapping(), time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.Entries) != 2 {
+				t.Fatalf("entries = %d, errors = %v", len(res.Entries), res.Errors)
+			}
+			if e := res.Entries[0]; e.Event != tt.event || strings.Join(e.Tags, "|") != tt.tags {
+				t.Errorf("entry = %+v", e)
+			}
+			if e := res.Entries[1]; e.Event != "'引号开头" {
+				t.Errorf("entry = %+v", e)
+			}
+		})
+	}
+}
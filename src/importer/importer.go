@@ -0,0 +1,316 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NgeKaworu/time-mgt-go/src/models"
+)
+
+// MaxRows 单次导入的最大行数
+const MaxRows = 50000
+
+// Entry 一条待导入的记录
+type Entry struct {
+	Line    int       // csv的行号, json为第几条记录
+	Event   string    // 事件
+	Tags    []string  // 标签名
+	StartAt time.Time // 开始时间
+	EndAt   time.Time // 结束时间
+}
+
+// Result 解析结果
+type Result struct {
+	Total   int                  // 数据行数
+	Entries []Entry              // 解析成功的记录
+	Colors  map[string]string    // 源数据带有的标签颜色, 以标签名为key
+	Errors  []models.ImportError // 各行的错误
+}
+
+// 导入来源
+const (
+	SourceCSV      = "csv"      // 通用csv
+	SourceToggl    = "toggl"    // Toggl Track导出的csv或json
+	SourceClockify = "clockify" // Clockify导出的csv或json
+)
+
+// Parse 按来源解析导入文件, 通用csv使用列名映射m
+func Parse(source string, r io.Reader, m Mapping, loc *time.Location) (*Result, error) {
+	switch source {
+	case "", SourceCSV:
+		return ParseCSV(r, m, loc)
+	case SourceToggl:
+		return ParseToggl(r, loc)
+	case SourceClockify:
+		return ParseClockify(r, loc)
+	}
+	return nil, errors.New("不支持的导入来源")
+}
+
+// newResult 工厂方法
+func newResult() *Result {
+	return &Result{Colors: make(map[string]string)}
+}
+
+// add 校验一行并加入结果, 时间和时长为源数据中的原始字符串
+func (r *Result) add(line int, event string, tags []string, start, end, duration string, loc *time.Location) {
+	event = strings.TrimSpace(event)
+	if event == "" {
+		r.fail(line, "event", "请填写发生了什么")
+		return
+	}
+
+	startAt, endAt, field, err := interval(start, end, duration, loc)
+	if err != nil {
+		r.fail(line, field, err.Error())
+		return
+	}
+
+	r.Entries = append(r.Entries, Entry{
+		Line:    line,
+		Event:   event,
+		Tags:    tags,
+		StartAt: startAt,
+		EndAt:   endAt,
+	})
+}
+
+// color 记录标签颜色, 同名标签以先出现的为准
+func (r *Result) color(name, color string) {
+	name, color = strings.TrimSpace(name), strings.TrimSpace(color)
+	if name == "" || color == "" {
+		return
+	}
+	if _, ok := r.Colors[name]; !ok {
+		r.Colors[name] = color
+	}
+}
+
+// fail 记录一行的错误
+func (r *Result) fail(line int, field, message string) {
+	r.Errors = append(r.Errors, models.ImportError{
+		Line:    line,
+		Field:   field,
+		Message: message,
+	})
+}
+
+// timeLayouts 支持的时间格式, 不带时区的按用户时区解释
+var timeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"2006-01-02 03:04:05 PM",
+	"2006-01-02 03:04 PM",
+	"01/02/2006 03:04:05 PM",
+	"01/02/2006 03:04 PM",
+}
+
+// ParseTime 解析时间, 支持RFC3339及常见的表格格式
+func ParseTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("时间格式错误")
+}
+
+// isoDuration ISO 8601时长, 如PT1H30M5S
+var isoDuration = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?$`)
+
+// ParseDuration 解析时长, 支持"1h30m"、"1:30:00"/"1:30"(时:分:秒/时:分)或ISO 8601的"PT1H30M"格式
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	if m := isoDuration.FindStringSubmatch(s); m != nil && s != "PT" {
+		var d time.Duration
+		for i, unit := range []time.Duration{time.Hour, time.Minute} {
+			if m[i+1] != "" {
+				n, _ := strconv.ParseInt(m[i+1], 10, 64)
+				d += time.Duration(n) * unit
+			}
+		}
+		if m[3] != "" {
+			n, _ := strconv.ParseFloat(m[3], 64)
+			d += time.Duration(n * float64(time.Second))
+		}
+		return d, nil
+	}
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, errors.New("时长格式错误")
+	}
+
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || (i > 0 && n >= 60) {
+			return 0, errors.New("时长格式错误")
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
+// interval 由开始时间、结束时间、时长中的任意两项得出区间
+func interval(start, end, duration string, loc *time.Location) (time.Time, time.Time, string, error) {
+	var startAt, endAt time.Time
+	var err error
+
+	if start != "" {
+		startAt, err = ParseTime(start, loc)
+		if err != nil {
+			return startAt, endAt, "start", err
+		}
+	}
+	if end != "" {
+		endAt, err = ParseTime(end, loc)
+		if err != nil {
+			return startAt, endAt, "end", err
+		}
+	}
+
+	if start == "" || end == "" {
+		if duration == "" {
+			return startAt, endAt, "duration", errors.New("开始时间、结束时间和时长至少填写两项")
+		}
+		d, err := ParseDuration(duration)
+		if err != nil {
+			return startAt, endAt, "duration", err
+		}
+		switch {
+		case start != "":
+			endAt = startAt.Add(d)
+		case end != "":
+			startAt = endAt.Add(-d)
+		default:
+			return startAt, endAt, "start", errors.New("开始时间和结束时间至少填写一项")
+		}
+	}
+
+	if !endAt.After(startAt) {
+		return startAt, endAt, "end", errors.New("结束时间必须晚于开始时间")
+	}
+	return startAt, endAt, "", nil
+}
+
+// splitTags 拆分标签名, 去掉空白和重复
+func splitTags(s, sep string) []string {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, sep) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	return tags
+}
+
+// sniffJSON 判断内容是否为json(以[或{开头), 返回的reader保留了已读取的内容
+func sniffJSON(r io.Reader) (*bufio.Reader, bool) {
+	br := bufio.NewReader(r)
+	for {
+		c, _, err := br.ReadRune()
+		if err != nil {
+			return br, false
+		}
+		if c == '\uFEFF' || c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+		br.UnreadRune()
+		return br, c == '[' || c == '{'
+	}
+}
+
+// decodeEntries 把json格式的条目列表解码到list, 顶层可以是数组, 也可以是以keys中某个字段包装数组的对象
+func decodeEntries(r io.Reader, list interface{}, keys ...string) error {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return errors.New("json格式错误: " + err.Error())
+	}
+
+	if !strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		var wrapper map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &wrapper); err != nil {
+			return errors.New("json格式错误: " + err.Error())
+		}
+		raw = nil
+		for _, key := range keys {
+			if v, ok := wrapper[key]; ok {
+				raw = v
+				break
+			}
+		}
+		if raw == nil {
+			return errors.New("找不到时间条目")
+		}
+	}
+
+	if err := json.Unmarshal(raw, list); err != nil {
+		return errors.New("json格式错误: " + err.Error())
+	}
+	return nil
+}
+
+// durationValue json中的时长, 数字为秒数, 字符串按ParseDuration的格式
+type durationValue string
+
+// UnmarshalJSON 实现json.Unmarshaler
+func (d *durationValue) UnmarshalJSON(b []byte) error {
+	if n, err := strconv.ParseFloat(string(b), 64); err == nil {
+		*d = durationValue((time.Duration(n * float64(time.Second))).String())
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*d = durationValue(s)
+	return nil
+}
+
+// dateTime 拼接分开的日期和时间列, 任一为空时返回空串
+func dateTime(date, clock string) string {
+	if date == "" || clock == "" {
+		return ""
+	}
+	return date + " " + clock
+}
+
+// joinTags 项目名作为第一个标签, 与其余标签合并去重
+func joinTags(project string, tags []string) []string {
+	return splitTags(strings.Join(append([]string{project}, tags...), "\x00"), "\x00")
+}
+
+// firstOf 返回第一个非空的字符串
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
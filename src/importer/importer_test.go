@@ -0,0 +1,74 @@
+package importer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{in: "1h30m", want: 90 * time.Minute},
+		{in: " 45m ", want: 45 * time.Minute},
+		{in: "PT1H30M", want: 90 * time.Minute},
+		{in: "PT45M", want: 45 * time.Minute},
+		{in: "PT2H", want: 2 * time.Hour},
+		{in: "PT1.5S", want: 1500 * time.Millisecond},
+		{in: "PT1H0M5S", want: time.Hour + 5*time.Second},
+		{in: "1:30", want: 90 * time.Minute},
+		{in: "01:30:15", want: 90*time.Minute + 15*time.Second},
+		{in: "25:00", want: 25 * time.Hour},
+		{in: "0:05", want: 5 * time.Minute},
+		{in: "PT", err: true},
+		{in: "P1D", err: true},
+		{in: "PT1X", err: true},
+		{in: "1:75", err: true},
+		{in: "1:30:60", err: true},
+		{in: "1:-5", err: true},
+		{in: "1:2:3:4", err: true},
+		{in: "90", err: true},
+		{in: "", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseDuration(%q) = %v, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-01-15T09:00:00Z", time.Date(2024, 1, 15, 17, 0, 0, 0, loc)},
+		{"2024-01-15 09:00", time.Date(2024, 1, 15, 9, 0, 0, 0, loc)},
+		{"01/15/2024 09:00:00 AM", time.Date(2024, 1, 15, 9, 0, 0, 0, loc)},
+		{"01/15/2024 12:00:00 AM", time.Date(2024, 1, 15, 0, 0, 0, 0, loc)},
+		{"01/15/2024 12:30 PM", time.Date(2024, 1, 15, 12, 30, 0, 0, loc)},
+		{"2024-01-15 01:30:00 PM", time.Date(2024, 1, 15, 13, 30, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in, loc)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseTime(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := ParseTime("15/01/2024 09:00", loc); err == nil {
+		t.Error("day first should fail")
+	}
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// togglEntry Toggl Track导出的时间条目, 兼容API(v9)和详细报表(v2)两种json
+type togglEntry struct {
+	Description  string   `json:"description"`
+	Start        string   `json:"start"`
+	Stop         string   `json:"stop"`              // API
+	End          string   `json:"end"`               // 报表
+	Duration     *float64 `json:"duration"`          // API, 秒, 计时中为负数
+	Dur          *float64 `json:"dur"`               // 报表, 毫秒
+	Project      string   `json:"project"`           // 报表中的项目名
+	ProjectName  string   `json:"project_name"`      // API带项目信息时的项目名
+	ProjectColor string   `json:"project_hex_color"` // 报表中的项目颜色
+	Color        string   `json:"project_color"`     // API带项目信息时的项目颜色
+	Tags         []string `json:"tags"`
+}
+
+// ParseToggl 解析Toggl Track导出的csv或json, 项目和标签都转为标签, 项目带颜色
+func ParseToggl(r io.Reader, loc *time.Location) (*Result, error) {
+	br, isJSON := sniffJSON(r)
+	if !isJSON {
+		return parseTogglCSV(br, loc)
+	}
+
+	var entries []togglEntry
+	if err := decodeEntries(br, &entries, "data"); err != nil {
+		return nil, err
+	}
+
+	res := newResult()
+	if len(entries) > MaxRows {
+		return nil, errors.New("单次导入的行数过多")
+	}
+	for i, e := range entries {
+		line := i + 1
+		res.Total++
+
+		project := firstOf(e.Project, e.ProjectName)
+		res.color(project, firstOf(e.ProjectColor, e.Color))
+
+		var duration string
+		switch {
+		case e.Duration != nil:
+			if *e.Duration < 0 {
+				res.fail(line, "duration", "计时尚未结束")
+				continue
+			}
+			duration = (time.Duration(*e.Duration) * time.Second).String()
+		case e.Dur != nil:
+			duration = (time.Duration(*e.Dur) * time.Millisecond).String()
+		}
+
+		res.add(line, firstOf(e.Description, project), joinTags(project, e.Tags),
+			e.Start, firstOf(e.Stop, e.End), duration, loc)
+	}
+	return res, nil
+}
+
+// parseTogglCSV 解析Toggl Track详细报表导出的csv, 日期和时间分两列
+func parseTogglCSV(r io.Reader, loc *time.Location) (*Result, error) {
+	res := newResult()
+	err := eachRow(r, res, []string{"Description", "Start date", "Start time"}, func(line int, cell func(names ...string) string) {
+		project := cell("Project")
+		res.add(line, firstOf(cell("Description"), project), joinTags(project, strings.Split(cell("Tags"), ",")),
+			dateTime(cell("Start date"), cell("Start time")),
+			dateTime(cell("End date"), cell("End time")),
+			cell("Duration"), loc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,86 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTogglCSV(t *testing.T) {
+	in := "User,Email,Client,Project,Task,Description,Billable,Start date,Start time,End date,End time,Duration,Tags,Amount ()\n" +
+		"Ann,ann@example.com,,Work,,Coding,No,2024-01-15,09:00:00,2024-01-15,10:30:00,01:30:00,\"dev, focus\",\n" +
+		"Ann,ann@example.com,,Meeting,,,No,2024-01-15,01:30:00 PM,2024-01-15,02:00:00 PM,00:30:00,,\n" +
+		"Ann,ann@example.com,,Work,,Overnight,No,2024-01-15,23:30:00,2024-01-16,00:30:00,01:00:00,Work,\n" +
+		"Ann,ann@example.com,,Work,,Broken,No,2024-01-15,9 o'clock,,,,,\n"
+
+	loc := time.FixedZone("CST", 8*3600)
+	res, err := ParseToggl(strings.NewReader(in), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 4 || len(res.Entries) != 3 || len(res.Errors) != 1 || res.Errors[0].Line != 5 {
+		t.Fatalf("total = %d, entries = %+v, errors = %+v", res.Total, res.Entries, res.Errors)
+	}
+
+	tests := []struct {
+		event      string
+		tags       string
+		start, end time.Time
+	}{
+		{"Coding", "Work|dev|focus", time.Date(2024, 1, 15, 9, 0, 0, 0, loc), time.Date(2024, 1, 15, 10, 30, 0, 0, loc)},
+		// 没有描述时以项目名为事件
+		{"Meeting", "Meeting", time.Date(2024, 1, 15, 13, 30, 0, 0, loc), time.Date(2024, 1, 15, 14, 0, 0, 0, loc)},
+		// 标签与项目同名时去重
+		{"Overnight", "Work", time.Date(2024, 1, 15, 23, 30, 0, 0, loc), time.Date(2024, 1, 16, 0, 30, 0, 0, loc)},
+	}
+	for i, want := range tests {
+		e := res.Entries[i]
+		if e.Event != want.event || strings.Join(e.Tags, "|") != want.tags ||
+			!e.StartAt.Equal(want.start) || !e.EndAt.Equal(want.end) {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want)
+		}
+	}
+}
+
+func TestParseTogglJSON(t *testing.T) {
+	// API(v9)导出, 第二条仍在计时
+	api := `[
+		{"description": "Review", "start": "2024-01-15T01:00:00Z", "stop": "2024-01-15T02:00:00Z",
+		 "duration": 3600, "project_name": "Work", "project_color": "#06aaf5", "tags": ["review"]},
+		{"description": "Running", "start": "2024-01-15T03:00:00Z", "duration": -1705287600, "project_name": "Work"}
+	]`
+	res, err := ParseToggl(strings.NewReader(api), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 2 || len(res.Entries) != 1 || len(res.Errors) != 1 || res.Errors[0].Field != "duration" {
+		t.Fatalf("total = %d, entries = %+v, errors = %+v", res.Total, res.Entries, res.Errors)
+	}
+	e := res.Entries[0]
+	if e.Event != "Review" || strings.Join(e.Tags, "|") != "Work|review" || e.EndAt.Sub(e.StartAt) != time.Hour {
+		t.Errorf("entry = %+v", e)
+	}
+	if res.Colors["Work"] != "#06aaf5" {
+		t.Errorf("colors = %v", res.Colors)
+	}
+
+	// 详细报表(v2)导出, 条目在data中, 时长为毫秒
+	report := `{"total_count": 1, "data": [
+		{"description": "", "start": "2024-01-15T10:00:00+08:00", "dur": 1800000,
+		 "project": "Meeting", "project_hex_color": "#c56bff", "tags": []}
+	]}`
+	res, err = ParseToggl(strings.NewReader(report), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Entries) != 1 {
+		t.Fatalf("entries = %+v, errors = %+v", res.Entries, res.Errors)
+	}
+	e = res.Entries[0]
+	if e.Event != "Meeting" || !e.EndAt.Equal(time.Date(2024, 1, 15, 2, 30, 0, 0, time.UTC)) {
+		t.Errorf("entry = %+v", e)
+	}
+	if res.Colors["Meeting"] != "#c56bff" {
+		t.Errorf("colors = %v", res.Colors)
+	}
+}
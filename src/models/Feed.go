@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TFeed 日历订阅表
+const TFeed = "t_feed"
+
+// Feed 日历订阅schema, 只保存令牌的哈希, 令牌只在创建时返回一次
+type Feed struct {
+	ID         *primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`                // id
+	UID        *primitive.ObjectID `json:"uid,omitempty" bson:"uid,omitempty"`               // uid
+	Name       *string             `json:"name,omitempty" bson:"name,omitempty"`             // 名称
+	Hash       *string             `json:"-" bson:"hash,omitempty"`                          // 令牌的sha256
+	Token      *string             `json:"token,omitempty" bson:"-"`                         // 令牌, 仅创建时返回
+	URL        *string             `json:"url,omitempty" bson:"-"`                           // 订阅路径, 仅创建时返回
+	CreateAt   *time.Time          `json:"createAt,omitempty" bson:"createAt,omitempty"`     // 创建时间
+	LastUsedAt *time.Time          `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"` // 最近被拉取的时间
+}
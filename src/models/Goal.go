@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TGoal 目标表
+const TGoal = "t_goal"
+
+// 目标类型
+const (
+	GoalAtLeast = "atLeast" // 至少
+	GoalAtMost  = "atMost"  // 至多
+)
+
+// Goal 目标schema
+type Goal struct {
+	ID       *primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`            // id
+	UID      *primitive.ObjectID `json:"uid,omitempty" bson:"uid,omitempty"`           // uid
+	TID      *primitive.ObjectID `json:"tid,omitempty" bson:"tid,omitempty"`           // tid
+	Kind     *string             `json:"kind,omitempty" bson:"kind,omitempty"`         // 类型
+	Target   *time.Duration      `json:"target,omitempty" bson:"target,omitempty"`     // 目标时长
+	Period   *string             `json:"period,omitempty" bson:"period,omitempty"`     // 周期 day/week/month
+	CreateAt *time.Time          `json:"createAt,omitempty" bson:"createAt,omitempty"` // 创建时间
+	UpdateAt *time.Time          `json:"updateAt,omitempty" bson:"updateAt,omitempty"` // 更新时间
+}
+
+// GoalProgress 目标在当前周期的进度
+type GoalProgress struct {
+	Goal
+	Start     *time.Time    `json:"start,omitempty"` // 周期开始
+	End       *time.Time    `json:"end,omitempty"`   // 周期结束(不含)
+	Achieved  time.Duration `json:"achieved"`        // 已完成时长
+	Remaining time.Duration `json:"remaining"`       // 距目标还差的时长, 至多类型为剩余额度
+	OnTrack   bool          `json:"onTrack"`         // 是否按计划进行
+}
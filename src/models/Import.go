@@ -0,0 +1,18 @@
+package models
+
+// ImportError 导入时某一行的错误
+type ImportError struct {
+	Line    int    `json:"line"`            // csv的行号(表头为第1行), json为第几条记录
+	Field   string `json:"field,omitempty"` // 出错的字段
+	Message string `json:"message"`         // 错误信息
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	DryRun   bool          `json:"dryRun"`   // 是否只校验不写入
+	Total    int           `json:"total"`    // 数据行数
+	Valid    int           `json:"valid"`    // 校验通过的行数
+	Imported int           `json:"imported"` // 实际写入的记录数, 有错误时不写入
+	NewTags  []string      `json:"newTags"`  // 需要新建的标签
+	Errors   []ImportError `json:"errors"`   // 各行的错误
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TPreference 用户偏好表
+const TPreference = "t_preference"
+
+// Preference 用户偏好schema, 每个用户一条
+type Preference struct {
+	ID        *primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`              // id
+	UID       *primitive.ObjectID `json:"uid,omitempty" bson:"uid,omitempty"`             // uid
+	Timezone  *string             `json:"timezone,omitempty" bson:"timezone,omitempty"`   // 时区, 如Asia/Shanghai
+	WeekStart *time.Weekday       `json:"weekStart,omitempty" bson:"weekStart,omitempty"` // 每周第一天, 星期日为0
+	Locale    *string             `json:"locale,omitempty" bson:"locale,omitempty"`       // 语言, 如zh-CN
+	CreateAt  *time.Time          `json:"createAt,omitempty" bson:"createAt,omitempty"`   // 创建时间
+	UpdateAt  *time.Time          `json:"updateAt,omitempty" bson:"updateAt,omitempty"`   // 更新时间
+}
@@ -15,7 +15,29 @@ type Record struct {
 	UID      *primitive.ObjectID   `json:"uid,omitempty" bson:"uid,omitempty"`           // uid
 	TID      *[]primitive.ObjectID `json:"tid,omitempty" bson:"tid,omitempty"`           // tid
 	Event    *string               `json:"event,omitempty" bson:"event,omitempty"`       // 事件
+	StartAt  *time.Time            `json:"startAt,omitempty" bson:"startAt,omitempty"`   // 开始时间, 为空时从上一条记录开始
+	EndAt    *time.Time            `json:"endAt,omitempty" bson:"endAt,omitempty"`       // 结束时间
 	CreateAt *time.Time            `json:"createAt,omitempty" bson:"createAt,omitempty"` // 创建时间
 	UpdateAt *time.Time            `json:"updateAt,omitempty" bson:"updateAt,omitempty"` // 更新时间
 	Deration *time.Duration        `json:"deration,omitempty" bson:"deration,omitempty"` // 持续时间
 }
+
+// Interval 记录覆盖的时间区间, 连续记录为[createAt-deration, createAt]
+func (r *Record) Interval() (time.Time, time.Time) {
+	if r.StartAt != nil && r.EndAt != nil {
+		return *r.StartAt, *r.EndAt
+	}
+
+	var deration time.Duration
+	if r.Deration != nil {
+		deration = *r.Deration
+	}
+	return r.CreateAt.Add(-deration), *r.CreateAt
+}
+
+// SearchHit 搜索结果
+type SearchHit struct {
+	Record  `bson:",inline"`
+	Score   float64 `json:"score" bson:"score"` // 相关度
+	Snippet string  `json:"snippet" bson:"-"`   // 高亮片段, 命中词以<em>包裹
+}
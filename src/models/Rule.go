@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TRule 自动打标签规则表
+const TRule = "t_rule"
+
+// Rule 自动打标签规则schema, 事件匹配Pattern时打上TID中的标签
+type Rule struct {
+	ID       *primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`            // id
+	UID      *primitive.ObjectID   `json:"uid,omitempty" bson:"uid,omitempty"`           // uid
+	Pattern  *string               `json:"pattern,omitempty" bson:"pattern,omitempty"`   // 正则
+	TID      *[]primitive.ObjectID `json:"tid,omitempty" bson:"tid,omitempty"`           // tid
+	CreateAt *time.Time            `json:"createAt,omitempty" bson:"createAt,omitempty"` // 创建时间
+	UpdateAt *time.Time            `json:"updateAt,omitempty" bson:"updateAt,omitempty"` // 更新时间
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Untagged 未打标签记录的统计名称
+const Untagged = "未打标签"
+
+// Statistic 标签统计结果
+type Statistic struct {
+	TID      *primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`            // tid, 与原先以Record返回时的id一致, 为空时为未打标签的记录
+	GID      *primitive.ObjectID `json:"gid,omitempty" bson:"gid,omitempty"`           // 分组id, 仅按分组统计时返回
+	Name     *string             `json:"name,omitempty" bson:"name,omitempty"`         // 标签名
+	Color    *string             `json:"color,omitempty" bson:"color,omitempty"`       // 颜色
+	Deration *time.Duration      `json:"deration,omitempty" bson:"deration,omitempty"` // 持续时间
+	Count    *int64              `json:"count,omitempty" bson:"count,omitempty"`       // 记录数
+	Share    *float64            `json:"share,omitempty" bson:"share,omitempty"`       // 占总时长的比例
+}
+
+// Series 按时间段统计的一个区间
+type Series struct {
+	Start *time.Time  `json:"start,omitempty"` // 区间开始
+	End   *time.Time  `json:"end,omitempty"`   // 区间结束(不含)
+	Items []Statistic `json:"items"`           // 各标签时长
+}
+
+// Distribution 标签在一周内各小时的时长分布
+type Distribution struct {
+	Statistic
+	Matrix [7][24]time.Duration `json:"matrix"` // [星期][小时], 星期日为0
+}
+
+// StatisticDelta 标签本期与上期的时长变化
+type StatisticDelta struct {
+	TID      *primitive.ObjectID `json:"id,omitempty"`      // tid, 与Statistic一致, 为空时为未打标签的记录
+	GID      *primitive.ObjectID `json:"gid,omitempty"`     // 分组id, 仅按分组统计时返回
+	Name     *string             `json:"name,omitempty"`    // 标签名
+	Color    *string             `json:"color,omitempty"`   // 颜色
+	Current  time.Duration       `json:"current"`           // 本期时长
+	Previous time.Duration       `json:"previous"`          // 上期时长
+	Delta    time.Duration       `json:"delta"`             // 变化量
+	Percent  *float64            `json:"percent,omitempty"` // 变化百分比, 上期为0时为空
+}
+
+// Comparison 对比统计结果
+type Comparison struct {
+	DateRange         []time.Time      `json:"dateRange"`         // 本期范围
+	PreviousDateRange []time.Time      `json:"previousDateRange"` // 上期范围
+	Current           []Statistic      `json:"current"`           // 本期统计
+	Previous          []Statistic      `json:"previous"`          // 上期统计
+	Deltas            []StatisticDelta `json:"deltas"`            // 各标签变化
+}
+
+// StreakDay 连续打卡日历中的一天
+type StreakDay struct {
+	Date     string        `json:"date"`     // 日期 2006-01-02
+	Deration time.Duration `json:"deration"` // 当天时长
+	Hit      bool          `json:"hit"`      // 是否达标
+}
+
+// Streak 标签的连续达标天数
+type Streak struct {
+	TID      *primitive.ObjectID `json:"id,omitempty"`       // tid, 与Statistic一致
+	Current  int                 `json:"current"`            // 当前连续天数
+	Longest  int                 `json:"longest"`            // 最长连续天数
+	Calendar []StreakDay         `json:"calendar,omitempty"` // 每日达标情况
+}
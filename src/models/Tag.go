@@ -15,6 +15,19 @@ type Tag struct {
 	UID      *primitive.ObjectID `json:"uid,omitempty" bson:"uid,omitempty"`           // uid
 	Name     *string             `json:"name,omitempty" bson:"name,omitempty"`         // 标签名
 	Color    *string             `json:"color,omitempty" bson:"color,omitempty"`       // 颜色
+	ParentID *primitive.ObjectID `json:"parentId,omitempty" bson:"parentId,omitempty"` // 父标签id
+	Archived *bool               `json:"archived,omitempty" bson:"archived,omitempty"` // 是否已归档
+	GroupID  *primitive.ObjectID `json:"groupId,omitempty" bson:"groupId,omitempty"`   // 分组id
+	Sort     *int64              `json:"sort,omitempty" bson:"sort,omitempty"`         // 手动排序
 	CreateAt *time.Time          `json:"createAt,omitempty" bson:"createAt,omitempty"` // 创建时间
 	UpdateAt *time.Time          `json:"updateAt,omitempty" bson:"updateAt,omitempty"` // 更新时间
+	Children []Tag               `json:"children,omitempty" bson:"-"`                  // 子标签, 仅树形列表返回
+	Usage    *TagUsage           `json:"usage,omitempty" bson:"-"`                     // 使用情况, 仅列表按需返回
+}
+
+// TagUsage 标签使用情况
+type TagUsage struct {
+	Count      int64         `json:"count" bson:"count"`                               // 记录数
+	Deration   time.Duration `json:"deration" bson:"deration"`                         // 总时长
+	LastUsedAt *time.Time    `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"` // 最近使用时间
 }
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TTagGroup 标签分组表
+const TTagGroup = "t_tag_group"
+
+// Ungrouped 未分组标签的名称
+const Ungrouped = "未分组"
+
+// TagGroup 标签分组schema
+type TagGroup struct {
+	ID       *primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`            // id
+	UID      *primitive.ObjectID `json:"uid,omitempty" bson:"uid,omitempty"`           // uid
+	Name     *string             `json:"name,omitempty" bson:"name,omitempty"`         // 分组名
+	Sort     *int64              `json:"sort,omitempty" bson:"sort,omitempty"`         // 排序
+	CreateAt *time.Time          `json:"createAt,omitempty" bson:"createAt,omitempty"` // 创建时间
+	UpdateAt *time.Time          `json:"updateAt,omitempty" bson:"updateAt,omitempty"` // 更新时间
+	Tags     []Tag               `json:"tags,omitempty" bson:"-"`                      // 组内标签, 仅分组列表返回
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TimerKey 计时器在redis中的key前缀
+const TimerKey = "time-mgt:timer:"
+
+// Timer 计时器schema, 以json存于redis
+type Timer struct {
+	TID      *[]primitive.ObjectID `json:"tid,omitempty"`      // tid
+	Event    *string               `json:"event,omitempty"`    // 事件
+	StartAt  *time.Time            `json:"startAt,omitempty"`  // 开始时间
+	Deration *time.Duration        `json:"deration,omitempty"` // 已进行时间, 仅查询时返回
+}
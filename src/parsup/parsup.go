@@ -115,6 +115,9 @@ func (p *ParamsSupport) ConvStr(s string) (interface{}, error) {
 func (p *ParamsSupport) ConvMap(m map[string]interface{}) (map[string]interface{}, error) {
 	res := make(map[string]interface{})
 	for k, v := range m {
+		if *p.IsDenyInject && strings.HasPrefix(k, "$") {
+			return nil, errors.New("字段名不能以$开头")
+		}
 		dv, err := p.ConvBase(v)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,71 @@
+package resultor
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// csvFlushRows 每写入多少行刷新一次输出
+const csvFlushRows = 500
+
+// csvFormulaPrefix 以这些字符开头的单元格会被表格软件当作公式
+const csvFormulaPrefix = "=+-@\t\r"
+
+// CSVWriter 流式csv处理器, 边写边输出, 不在内存中缓存全部数据
+type CSVWriter struct {
+	w    http.ResponseWriter
+	cw   *csv.Writer
+	rows int
+}
+
+// NewCSV 工厂方法, 写入响应头和表头; 写入后不能再用RetFail返回错误
+func NewCSV(w http.ResponseWriter, filename string, header []string) (*CSVWriter, error) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(filename))
+
+	// 带BOM, Excel才能正确识别中文
+	if _, err := w.Write([]byte("\xEF\xBB\xBF")); err != nil {
+		return nil, err
+	}
+
+	c := &CSVWriter{w: w, cw: csv.NewWriter(w)}
+	if err := c.cw.Write(header); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write 写入一行
+func (c *CSVWriter) Write(row []string) error {
+	if err := c.cw.Write(row); err != nil {
+		return err
+	}
+
+	c.rows++
+	if c.rows%csvFlushRows == 0 {
+		return c.Flush()
+	}
+	return nil
+}
+
+// Flush 把缓冲的数据发送给客户端
+func (c *CSVWriter) Flush() error {
+	c.cw.Flush()
+	if err := c.cw.Error(); err != nil {
+		return err
+	}
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// CSVText 转义用户填写的文本, 以公式字符开头时在前面加单引号, 避免打开导出文件时执行公式
+func CSVText(s string) string {
+	if s != "" && strings.ContainsRune(csvFormulaPrefix, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
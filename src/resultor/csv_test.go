@@ -0,0 +1,24 @@
+package resultor
+
+import "testing"
+
+func TestCSVText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"写代码", "写代码"},
+		{"=1+1", "'=1+1"},
+		{"+86 电话", "'+86 电话"},
+		{"-cmd", "'-cmd"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+	}
+	for _, tt := range tests {
+		if got := CSVText(tt.in); got != tt.want {
+			t.Errorf("CSVText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
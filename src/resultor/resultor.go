@@ -58,3 +58,38 @@ func RetOkWithTotal(w http.ResponseWriter, data interface{}, total int64) {
 
 	fmt.Fprint(w, string(b))
 }
+
+// RetOkWithCursor 游标分页成功处理器, next/prev为空表示没有下一页/上一页
+func RetOkWithCursor(w http.ResponseWriter, data interface{}, next, prev string) {
+	res := map[string]interface{}{
+		"ok":   true,
+		"data": data,
+		"next": next,
+		"prev": prev,
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		RetFail(w, err)
+		return
+	}
+
+	fmt.Fprint(w, string(b))
+}
+
+// RetOkWithTotalCursor 带总数和游标的分页成功处理器, next/prev为空表示没有下一页/上一页
+func RetOkWithTotalCursor(w http.ResponseWriter, data interface{}, total int64, next, prev string) {
+	res := map[string]interface{}{
+		"ok":    true,
+		"data":  data,
+		"total": total,
+		"next":  next,
+		"prev":  prev,
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		RetFail(w, err)
+		return
+	}
+
+	fmt.Fprint(w, string(b))
+}
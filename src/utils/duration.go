@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// Duration 解析时长, 支持纳秒数或"1h30m"格式的字符串
+func Duration(v interface{}) (time.Duration, error) {
+	switch d := v.(type) {
+	case float64:
+		return time.Duration(d), nil
+	case int64:
+		return time.Duration(d), nil
+	case string:
+		res, err := time.ParseDuration(d)
+		if err != nil {
+			return 0, errors.New("时长格式错误")
+		}
+		return res, nil
+	}
+	return 0, errors.New("时长格式错误")
+}